@@ -3,12 +3,41 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 	"alpha_wx_notify/internal" // 导入内部包，包含空投服务和工具函数
 )
 
+// loadConfig 加载配置文件并按其中的log配置重新设置日志
+// 配置无法加载时程序无法继续，记录错误后退出
+func loadConfig() *internal.Config {
+	cfg, err := internal.LoadConfig("../config/config.json")
+	if err != nil {
+		slog.Error("加载配置失败", internal.LogKeyError, err)
+		exit(1)
+	}
+	internal.SetupLogging(cfg.Log, os.Stderr)
+	return cfg
+}
+
+// restoreOutput 恢复被脱敏拦截的标准输出，main启动时设置
+var restoreOutput = func() {}
+
+// exit 写完缓冲的输出后退出
+func exit(code int) {
+	restoreOutput()
+	os.Exit(code)
+}
+
 // ProcessAirdrops 处理空投信息的主要逻辑
 // 该函数负责:
 // 1. 加载配置文件
@@ -16,105 +45,564 @@ import (
 // 3. 获取并生成空投消息和快照
 // 4. 检测空投信息变化并决定是否推送通知
 // 5. 保存当前快照以便下次比较
-func ProcessAirdrops() {
-	fmt.Printf("[%s] 开始检查空投信息...\n", time.Now().Format("2006-01-02 15:04:05"))
-
+// 整个周期受cycleTimeout限制，ctx被取消（如收到退出信号）时尽快中止
+func ProcessAirdrops(ctx context.Context) {
 	// 加载配置文件
 	// 配置文件包含Server酱的SendKey、检查间隔和是否过滤TGE项目等设置
-	cfg, err := internal.LoadConfig("../config/config.json")
-	if err != nil {
-		log.Fatal(err) // 如果配置加载失败，程序无法继续运行，直接终止
-	}
+	cfg := loadConfig()
 
 	// 创建空投服务实例
 	// 空投服务负责获取空投数据、生成消息和快照、比较快照等核心功能
-	airdropService := internal.NewAirdropService(cfg)
+	runCycle(ctx, cfg, internal.NewAirdropService(cfg))
+}
+
+// runCycle 使用给定的服务执行一次检查
+// daemon模式在多个周期之间复用同一个服务，价格熔断器等状态得以保留
+// 参数:
+//   - ctx: 控制取消的上下文
+//   - cfg: 配置信息
+//   - airdropService: 空投服务实例
+func runCycle(ctx context.Context, cfg *internal.Config, airdropService *internal.AirdropService) {
+	// 每个检查周期有独立的cycle_id，本周期内的所有日志都带有该字段
+	ctx, _ = internal.NewCycleContext(ctx)
+	logger := internal.Logger(ctx)
+	logger.Info("开始检查空投信息")
+
+	// 周期结束时按结果计数，供指标使用
+	result := internal.CycleOK
+	defer func() { internal.RecordCycle(result) }()
+
+	// 为本次检查设置整体截止时间，超时后所有请求、重试等待和推送都会中止
+	ctx, cancel := context.WithTimeout(ctx, cfg.CycleDeadline())
+	defer cancel()
 
 	// 生成消息和快照
 	// msg: 格式化的消息内容，用于推送通知
 	// snapshot: 当前空投信息的快照，用于与上次快照比较检测变化
-	msg, snapshot := airdropService.GenerateMessageAndSnapshot()
+	msg, snapshot := airdropService.GenerateMessageAndSnapshot(ctx)
+
+	// 周期被取消时数据可能不完整，不能据此更新快照或推送
+	if ctx.Err() != nil {
+		logger.Warn("本次检查已中止", internal.LogKeyError, ctx.Err())
+		result = internal.CycleAborted
+		return
+	}
+
+	// 上游响应被隔离时通知运维人员，快照保持不变
+	// 同样的隔离原因只告警一次，告警发送成功后才记录
+	status := airdropService.LastDataStatus()
+	if len(status.Quarantined) > 0 && airdropService.QuarantineAlertDue() {
+		alert := "上游返回的空投数据可疑，已隔离，本次不更新快照：\n\n- " + strings.Join(status.Quarantined, "\n- ") +
+			"\n\n确认上游确实如此变化后，执行 accept-quarantine 把该响应作为新的比较基准。"
+		if err := internal.SendAlert(ctx, "空投数据异常", alert, cfg); err != nil {
+			logger.Error("发送告警失败", internal.LogKeyError, err)
+		} else {
+			airdropService.RecordQuarantineAlert(ctx)
+		}
+	}
+
+	// 上游字段结构发生新的变化时通知运维人员，避免字段改名后静默拿到空值
+	// 告警发送成功后才保存结构检查结果，发送失败时下个周期重新告警
+	if status.SchemaDrift != nil {
+		if err := internal.SendAlert(ctx, "空投接口结构变化", status.SchemaDrift.String(), cfg); err != nil {
+			logger.Error("发送告警失败", internal.LogKeyError, err)
+		} else {
+			airdropService.RecordSchemaReport(ctx)
+		}
+	} else {
+		airdropService.RecordSchemaReport(ctx)
+	}
+
+	// 上游和缓存都不可用时无法判断变化，保留上次快照
+	if !status.Available {
+		logger.Warn("未能获取空投数据，保留上次快照，跳过本次检查")
+		result = internal.CycleUnavailable
+		return
+	}
+
+	// 过期的缓存数据只用于展示，不能据此推送或更新快照
+	if status.Stale {
+		logger.Warn("当前数据来自缓存，跳过推送和快照更新",
+			internal.LogKeySource, status.Source, "fetched_at", status.FetchedAt.Format(time.RFC3339))
+		logger.Debug("消息内容", "msg", msg)
+		result = internal.CycleStale
+		return
+	}
+
+	// 积分不在快照中，单独比较
+	airdropService.RecordPointsChanges(ctx)
+
+	// 上游返回的所有空投写入归档，离开窗口后仍可查询
+	airdropService.ArchiveAirdrops(ctx)
+
+	// 开始前提醒与快照是否变化无关
+	airdropService.SendReminders(ctx)
+
+	// 到了配置的时间推送上周的统计
+	airdropService.SendWeeklyReport(ctx)
+
+	// 快照文件位于状态目录下
+	snapshotPath := cfg.StatePath(internal.SnapshotFile)
 
 	if msg != "" { // 如果有空投信息（消息不为空）
 		// 读取上次保存的快照文件
 		// 快照文件记录了上次检查时的空投信息，用于与当前信息比较
-		lastSnapshot, err := internal.LoadLastSnapshot("../data/last_snapshot.txt")
+		lastSnapshot, err := internal.LoadLastSnapshot(snapshotPath)
 		if err != nil {
-			fmt.Printf("读取上次快照失败: %v\n", err) // 读取失败时记录错误但继续执行
+			logger.Error("读取上次快照失败", internal.LogKeyError, err) // 读取失败时记录错误但继续执行
 		}
 
 		// 使用新的对比函数来忽略顺序比较两个快照是否相同
 		// 如果快照不同，说明空投信息有变化
 		if !airdropService.CompareSnapshots(snapshot, lastSnapshot) {
+			airdropService.RecordSnapshotChanges(ctx, lastSnapshot, snapshot)
+
 			// 检测变化类型：是新增了项目还是只是删除了项目
 			// isOnlyDeletion为true表示只有删除操作，没有新增项目
 			_, isOnlyDeletion := airdropService.DetectSnapshotChange(lastSnapshot, snapshot)
 
 			if isOnlyDeletion {
 				// 如果只是删除了项目，不进行推送，只更新快照
-				fmt.Println("检测到空投信息删除，不进行推送，仅更新快照...")
+				logger.Info("检测到空投信息删除，不进行推送，仅更新快照")
 				// 保存当前快照但不推送通知
-				if err := internal.SaveSnapshot(snapshot, "../data/last_snapshot.txt"); err != nil {
-					fmt.Printf("保存快照失败: %v\n", err)
+				if err := internal.SaveSnapshot(snapshot, snapshotPath); err != nil {
+					logger.Error("保存快照失败", internal.LogKeyError, err)
 				}
 			} else {
 				// 如果有新增项目或其他变化，推送通知
-				fmt.Println("检测到空投信息变化，推送通知...")
-				fmt.Println(msg) // 打印消息内容用于调试
+				logger.Info("检测到空投信息变化，推送通知")
+				logger.Debug("消息内容", "msg", msg) // 消息内容只在debug级别输出
 
-				// 通过Server酱推送通知
+				// 通过Server酱推送通知，配置了积分的接收人收到带资格列的表格
 				// 标题固定为"今日空投播报"
-				if err := internal.SendToServerChan(msg, "今日空投播报", cfg); err != nil {
-					fmt.Println("推送Server酱失败:", err)
-				} else {
-					fmt.Println("推送成功！")
+				if err := airdropService.SendToRecipients(ctx, msg, "今日空投播报"); err != nil {
+					logger.Error("推送中止", internal.LogKeyError, err)
 				}
 
 				// 保存当前快照，用于下次比较
-				if err := internal.SaveSnapshot(snapshot, "../data/last_snapshot.txt"); err != nil {
-					fmt.Printf("保存快照失败: %v\n", err)
+				if err := internal.SaveSnapshot(snapshot, snapshotPath); err != nil {
+					logger.Error("保存快照失败", internal.LogKeyError, err)
 				}
 			}
 		} else {
 			// 如果快照相同，说明空投信息没有变化，不需要推送
-			fmt.Println("空投信息无变化，跳过推送。")
+			logger.Info("空投信息无变化，跳过推送")
 		}
 	} else {
 		// 如果没有空投信息（消息为空）
-		fmt.Println("今日无空投信息。")
+		logger.Info("今日无空投信息")
 		
 		// 如果当前没有空投信息，但之前有，需要清空快照文件
 		// 这样可以避免下次检查时与空的当前状态比较导致误判
-		lastSnapshot, err := internal.LoadLastSnapshot("../data/last_snapshot.txt")
+		lastSnapshot, err := internal.LoadLastSnapshot(snapshotPath)
 		if err == nil && lastSnapshot != "" { // 如果上次快照存在且不为空
-			fmt.Println("清空快照文件...")
+			airdropService.RecordSnapshotChanges(ctx, lastSnapshot, "")
+			logger.Info("清空快照文件")
 			// 写入空字符串到快照文件，相当于清空文件
-			if err := internal.SaveSnapshot("", "../data/last_snapshot.txt"); err != nil {
-				fmt.Printf("清空快照失败: %v\n", err)
+			if err := internal.SaveSnapshot("", snapshotPath); err != nil {
+				logger.Error("清空快照失败", internal.LogKeyError, err)
 			}
 		}
 	}
 }
 
+// RunDaemon 常驻运行，每隔interval分钟执行一次检查，开启polling.adaptive时按空投开始时间调整间隔
+// 配置了server.listen时同时启动本地HTTP服务（/metrics、/healthz、/readyz、/api/和看板）
+// 看板上的"立即检查"会提前结束本次等待
+// 参数:
+//   - ctx: 控制取消的上下文，收到退出信号后在当前周期结束时返回
+func RunDaemon(ctx context.Context) {
+	cfg := loadConfig()
+	airdropService := internal.NewAirdropService(cfg)
+	if err := internal.StartServer(ctx, cfg.Server, internal.NewServeMux(cfg, airdropService)); err != nil {
+		slog.Error("启动本地HTTP服务失败", internal.LogKeyError, err)
+		exit(1)
+	}
+
+	slog.Info("进入常驻模式", "interval", cfg.CheckInterval().String(), "polling", cfg.Polling.Describe())
+
+	for {
+		runCycle(ctx, cfg, airdropService)
+		interval, reason := airdropService.NextInterval()
+		slog.Debug("等待下次检查", internal.LogKeyDelay, interval.String(), "reason", reason)
+		select {
+		case <-ctx.Done():
+			slog.Info("收到退出信号，停止检查")
+			return
+		case <-time.After(interval):
+		case <-airdropService.CheckRequests():
+			slog.Info("收到立即检查请求")
+		}
+	}
+}
+
+// PreviewAirdrops 预览当前的空投消息，不推送也不更新快照
+// 上游不可用时使用缓存数据，并在消息中标注为过期数据
+func PreviewAirdrops(ctx context.Context) {
+	previewWithConfig(ctx, loadConfig())
+}
+
+// ReplayCapture 使用录制文件离线复现一次检查，输出与preview相同
+// 回放期间不访问网络、不推送，也不读写缓存等状态文件；时间使用录制时的时间，重试不等待
+// 用法: replay [-cycle cycle_id] [-overrides] <录制文件>，不指定cycle时回放文件中的第一个检查周期
+// 参数:
+//   - ctx: 控制取消的上下文
+//   - args: replay之后的参数
+func ReplayCapture(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	cycle := fs.String("cycle", "", "要回放的检查周期cycle_id，默认为文件中的第一个")
+	overrides := fs.Bool("overrides", false, "同时应用本机的覆盖文件，默认不应用")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fmt.Println("用法: replay [-cycle cycle_id] [-overrides] <录制文件>")
+		exit(2)
+	}
+
+	cfg := loadConfig()
+	cfg.Capture = internal.CaptureConfig{Mode: internal.CaptureReplay, File: fs.Arg(0), Cycle: *cycle, Overrides: *overrides}
+	previewWithConfig(ctx, cfg)
+}
+
+// previewWithConfig 按给定配置生成一次消息并输出
+func previewWithConfig(ctx context.Context, cfg *internal.Config) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.CycleDeadline())
+	defer cancel()
+	ctx, _ = internal.NewCycleContext(ctx)
+
+	airdropService := internal.NewAirdropService(cfg)
+	msg, _ := airdropService.GenerateMessageAndSnapshot(ctx)
+
+	status := airdropService.LastDataStatus()
+	switch {
+	case !status.Available:
+		fmt.Println("未能获取空投数据，也没有可用的缓存。")
+	case msg == "":
+		fmt.Println("今日无空投信息。")
+	default:
+		fmt.Println(msg)
+		// 合并了多个来源时展示每个空投的来源和冲突
+		if report := internal.ProvenanceReport(airdropService.LastAirdrops()); report != "" {
+			fmt.Printf("数据来源（%s）:\n%s", status.Source, report)
+		}
+	}
+}
+
+// ExportCalendar 生成当前窗口内空投的iCalendar日历，不推送也不更新快照
+// 参数:
+//   - ctx: 控制取消的上下文
+//   - file: 输出文件，为空时输出到标准输出
+func ExportCalendar(ctx context.Context, file string) {
+	cfg := loadConfig()
+	ctx, cancel := context.WithTimeout(ctx, cfg.CycleDeadline())
+	defer cancel()
+	ctx, _ = internal.NewCycleContext(ctx)
+
+	airdropService := internal.NewAirdropService(cfg)
+	airdropService.GenerateMessageAndSnapshot(ctx)
+	if !airdropService.LastDataStatus().Available {
+		slog.Error("未能获取空投数据，也没有可用的缓存")
+		exit(1)
+	}
+
+	calendar := internal.BuildCalendar(cfg, airdropService.View().Airdrops, time.Now())
+	if file == "" {
+		fmt.Print(calendar)
+		return
+	}
+	if err := os.WriteFile(file, []byte(calendar), 0644); err != nil {
+		slog.Error("写入日历文件失败", internal.LogKeyPath, file, internal.LogKeyError, err)
+		exit(1)
+	}
+	slog.Info("已导出日历", internal.LogKeyPath, file, internal.LogKeyCount, len(airdropService.View().Airdrops))
+}
+
+// ExportFeed 把最近的变化事件写成订阅文件，不访问上游
+// 参数:
+//   - file: 输出文件，扩展名为.rss时输出RSS，否则输出Atom
+func ExportFeed(file string) {
+	cfg := loadConfig()
+	if err := internal.WriteFeedFile(cfg, file, time.Now()); err != nil {
+		slog.Error("写入订阅文件失败", internal.LogKeyPath, file, internal.LogKeyError, err)
+		exit(1)
+	}
+	slog.Info("已导出订阅文件", internal.LogKeyPath, file)
+}
+
+// AcceptQuarantine 把隔离的响应作为新的比较基准，不访问上游
+// 参数:
+//   - file: 隔离文件，为空时使用最近一次隔离的文件
+func AcceptQuarantine(file string) {
+	cfg := loadConfig()
+	accepted, err := internal.AcceptQuarantined(cfg, file)
+	if err != nil {
+		slog.Error("接受隔离的响应失败", internal.LogKeyError, err)
+		exit(1)
+	}
+	slog.Info("已把隔离的响应作为新的比较基准", internal.LogKeyPath, accepted)
+}
+
+// pointsUsage points命令的用法
+const pointsUsage = `用法:
+  points add <成员> balance <余额美元> [日期]   记录当天的余额档位积分
+  points add <成员> volume <交易量美元> [日期]  记录当天的交易量档位积分
+  points add <成员> spend <积分> [日期]         记录领取空投消耗的积分
+  points show [成员]                            输出最近15天的滚动积分和明细
+  points check                                  获取当前空投，输出每个成员是否达到积分门槛
+日期格式为2006-01-02，默认为今天`
+
+// PointsCommand 管理积分账本，账本保存在状态目录的points_ledger.json
+// 参数:
+//   - ctx: 控制取消的上下文，check获取空投时使用
+//   - args: points之后的参数
+func PointsCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		fmt.Println(pointsUsage)
+		exit(2)
+	}
+	cfg := loadConfig()
+	today := time.Now().In(cfg.Location())
+	ledger, err := internal.LoadLedger(cfg)
+	if err != nil {
+		slog.Error("读取积分账本失败", internal.LogKeyError, err)
+		exit(1)
+	}
+
+	switch args[0] {
+	case "add":
+		if len(args) < 4 || len(args) > 5 {
+			fmt.Println(pointsUsage)
+			exit(2)
+		}
+		member, kind := args[1], args[2]
+		value, err := strconv.ParseFloat(args[3], 64)
+		if err != nil || value < 0 {
+			fmt.Printf("数值必须是非负数: %s\n", args[3])
+			exit(2)
+		}
+		date := today
+		if len(args) == 5 {
+			if date, err = time.ParseInLocation("2006-01-02", args[4], cfg.Location()); err != nil {
+				fmt.Printf("日期格式错误: %s\n", args[4])
+				exit(2)
+			}
+		}
+		entry := internal.LedgerEntry{Date: date.Format("2006-01-02"), Kind: kind}
+		switch kind {
+		case internal.LedgerBalance:
+			entry.USD, entry.Points = value, internal.BalanceTierPoints(value)
+		case internal.LedgerVolume:
+			entry.USD, entry.Points = value, internal.VolumeTierPoints(value)
+		case internal.LedgerSpend:
+			entry.Points = int(value)
+		default:
+			fmt.Printf("未知类型: %s，可用类型: balance, volume, spend\n", kind)
+			exit(2)
+		}
+		ledger.Add(member, entry)
+		if err := internal.SaveLedger(cfg, ledger, today); err != nil {
+			slog.Error("保存积分账本失败", internal.LogKeyError, err)
+			exit(1)
+		}
+		score, _ := ledger.Score(member, today)
+		fmt.Printf("已记录 %s %s %s：%d分，最近%d天积分 %d\n", member, entry.Date, kind, entry.Points, internal.LedgerWindowDays, score)
+	case "show":
+		members := ledger.Members()
+		if len(args) > 1 {
+			if _, ok := ledger[args[1]]; !ok {
+				fmt.Printf("积分账本中没有成员%s\n", args[1])
+				exit(1)
+			}
+			members = args[1:2]
+		}
+		if len(members) == 0 {
+			fmt.Println("积分账本为空。")
+			return
+		}
+		fmt.Print(internal.LedgerReport(ledger, members, today))
+	case "check":
+		if len(ledger) == 0 {
+			fmt.Println("积分账本为空。")
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, cfg.CycleDeadline())
+		defer cancel()
+		ctx, _ = internal.NewCycleContext(ctx)
+		airdropService := internal.NewAirdropService(cfg)
+		airdropService.GenerateMessageAndSnapshot(ctx)
+		view := airdropService.View()
+		switch {
+		case !view.Status.Available:
+			fmt.Println("未能获取空投数据，也没有可用的缓存。")
+			exit(1)
+		case len(view.Airdrops) == 0:
+			fmt.Println("今日无空投信息。")
+		default:
+			fmt.Print(internal.EligibilityReport(ledger, view.Airdrops, today))
+		}
+	default:
+		fmt.Println(pointsUsage)
+		exit(2)
+	}
+}
+
+// QueryArchive 查询归档的空投，不访问上游
+// 用法: archive [-token 代币] [-from 日期] [-to 日期] [-type 类型] [-phase 阶段] [-json]
+// 参数:
+//   - args: archive之后的参数
+func QueryArchive(args []string) {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	var q internal.ArchiveQuery
+	fs.StringVar(&q.Token, "token", "", "代币符号，不区分大小写")
+	fs.StringVar(&q.From, "from", "", "空投日期下限（含），格式为2006-01-02")
+	fs.StringVar(&q.To, "to", "", "空投日期上限（含），格式为2006-01-02")
+	fs.StringVar(&q.Type, "type", "", "空投类型，如airdrop、tge")
+	fs.IntVar(&q.Phase, "phase", 0, "空投阶段")
+	asJSON := fs.Bool("json", false, "输出完整记录（含所有修订和价格）的JSON")
+	fs.Parse(args)
+
+	cfg := loadConfig()
+	records, err := internal.QueryArchive(cfg, q)
+	if err != nil {
+		slog.Error("查询归档失败", internal.LogKeyError, err)
+		exit(1)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if records == nil {
+			records = []internal.ArchiveRecord{}
+		}
+		enc.Encode(records)
+		return
+	}
+	if len(records) == 0 {
+		fmt.Println("没有符合条件的空投。")
+		return
+	}
+	fmt.Print(internal.ArchiveReport(records))
+	fmt.Printf("\n共 %d 个空投\n", len(records))
+}
+
+// ShowStats 输出归档空投的统计，不访问上游
+// 用法: stats [-days 天数] [-from 日期] [-to 日期] [-json]，默认统计最近7天（不含今天）
+// 参数:
+//   - args: stats之后的参数
+func ShowStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	days := fs.Int("days", 7, "统计最近多少天，不含今天；指定from时忽略")
+	from := fs.String("from", "", "空投日期下限（含），格式为2006-01-02")
+	to := fs.String("to", "", "空投日期上限（含），格式为2006-01-02，默认为昨天")
+	asJSON := fs.Bool("json", false, "以JSON输出")
+	fs.Parse(args)
+
+	cfg := loadConfig()
+	today := time.Now().In(cfg.Location())
+	if *to == "" {
+		*to = today.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	if *from == "" {
+		*from = today.AddDate(0, 0, -*days).Format("2006-01-02")
+	}
+	st, err := internal.LoadStats(cfg, *from, *to)
+	if err != nil {
+		slog.Error("查询归档失败", internal.LogKeyError, err)
+		exit(1)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(st)
+		return
+	}
+	fmt.Print(st.Report())
+}
+
 // main 程序入口函数
-// 调用ProcessAirdrops函数开始处理空投信息
-// 添加测试模式，直接输出API请求结果，验证请求头修改是否有效
+// 支持的子命令:
+//   - run: 执行一次完整检查（ProcessAirdrops），有变化时推送
+//   - daemon: 常驻运行，按interval循环检查（RunDaemon）
+//   - preview: 只输出当前消息，不推送（PreviewAirdrops）
+//   - replay [-cycle id] [-overrides] <file>: 用录制文件离线复现一个检查周期（ReplayCapture）
+//   - ics [file]: 导出iCalendar日历（ExportCalendar）
+//   - feed <file>: 导出变化事件的Atom/RSS订阅文件（ExportFeed）
+//   - accept-quarantine [file]: 把隔离的响应作为新的比较基准（AcceptQuarantine）
+//   - points ...: 管理积分账本、计算滚动积分（PointsCommand）
+//   - archive [flags]: 查询归档的历史空投（QueryArchive）
+//   - stats [flags]: 统计归档的空投（ShowStats）
+// 不带子命令时进入测试模式，直接输出API请求结果，验证请求头修改是否有效
 func main() {
+	// 所有日志和标准输出都先脱敏，避免SendKey、Cookie出现在控制台或Actions日志中
+	restoreOutput = internal.InstallRedaction()
+	defer restoreOutput()
+	// 加载配置前先按环境变量设置日志，配置加载后再按log配置调整
+	internal.SetupLogging(internal.LogConfig{}, os.Stderr)
+
+	// 收到Ctrl+C或SIGTERM时取消ctx，正在进行的请求和重试等待会立即中止
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			ProcessAirdrops(ctx)
+		case "daemon":
+			RunDaemon(ctx)
+		case "preview":
+			PreviewAirdrops(ctx)
+		case "replay":
+			ReplayCapture(ctx, os.Args[2:])
+		case "ics":
+			file := ""
+			if len(os.Args) > 2 {
+				file = os.Args[2]
+			}
+			ExportCalendar(ctx, file)
+		case "feed":
+			if len(os.Args) < 3 {
+				fmt.Println("用法: feed <输出文件，.rss为RSS，其他为Atom>")
+				exit(2)
+			}
+			ExportFeed(os.Args[2])
+		case "accept-quarantine":
+			file := ""
+			if len(os.Args) > 2 {
+				file = os.Args[2]
+			}
+			AcceptQuarantine(file)
+		case "points":
+			PointsCommand(ctx, os.Args[2:])
+		case "archive":
+			QueryArchive(os.Args[2:])
+		case "stats":
+			ShowStats(os.Args[2:])
+		default:
+			fmt.Printf("未知命令: %s\n可用命令: run, daemon, preview, replay, ics, feed, accept-quarantine, points, archive, stats\n", os.Args[1])
+			exit(2)
+		}
+		return
+	}
+
 	// 测试模式：直接获取API数据并输出结果，验证请求头修改是否有效
 	fmt.Println("=== 测试模式：验证API请求 ===")
 	
 	// 加载配置
 	cfg, err := internal.LoadConfig("../config/config.json")
 	if err != nil {
-		log.Printf("加载配置失败: %v\n", err)
+		slog.Warn("加载配置失败，使用默认设置继续测试", internal.LogKeyError, err)
 		// 即使配置加载失败，也继续测试API请求
+	} else {
+		internal.SetupLogging(cfg.Log, os.Stderr)
 	}
 
+	// 测试请求同样受周期超时限制
+	ctx, cancel := context.WithTimeout(ctx, cfg.CycleDeadline())
+	defer cancel()
+
 	// 创建空投服务实例
 	airdropService := internal.NewAirdropService(cfg)
 
 	// 获取空投数据
-	apiResp := airdropService.GetAirdropData()
+	apiResp, _ := airdropService.GetAirdropData(ctx)
 	if apiResp == nil {
 		fmt.Println("获取空投数据失败，请求可能仍然返回403错误")
 		return
@@ -145,7 +633,7 @@ func main() {
 	// start := time.Now()
 	
 	// 调用主要处理函数
-	// ProcessAirdrops()
+	// ProcessAirdrops(ctx)
 	
 	// 记录执行耗时
 	// fmt.Printf("处理完成，耗时: %v\n", time.Since(start))
@@ -1,10 +1,24 @@
 module alpha_wx_notify
 
-go 1.23
+go 1.23.0
+
+require (
+	github.com/PuerkitoBio/goquery v1.10.3
+	github.com/easychen/serverchan-sdk-golang v1.0.0
+	github.com/prometheus/client_golang v1.20.5
+	go.etcd.io/bbolt v1.4.3
+)
 
 require (
-	github.com/PuerkitoBio/goquery v1.10.3 // indirect
 	github.com/andybalholm/cascadia v1.3.3 // indirect
-	github.com/easychen/serverchan-sdk-golang v1.0.0 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/klauspost/compress v1.17.9 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
 	golang.org/x/net v0.41.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
 )
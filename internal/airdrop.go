@@ -3,14 +3,18 @@
 package internal
 
 import (
+	"context"       // 用于取消和超时控制
 	"encoding/json" // 用于JSON编解码
+	"errors"        // 用于错误判断
 	"fmt"           // 用于格式化输出
-	"log"           // 用于日志记录
+	"log/slog"      // 用于结构化日志
+	"math"          // 用于检查数量是否有效
 	"net/http"      // 用于HTTP请求
 	"os"            // 用于环境变量
 	"sort"          // 用于排序
 	"strconv"       // 用于字符串转换
 	"strings"       // 用于字符串处理
+	"sync"          // 用于保护供本地API读取的结果
 	"time"          // 用于时间处理
 )
 
@@ -30,6 +34,49 @@ type Airdrop struct {
 	Completed       bool        `json:"completed"`       // 是否已完成
 	ContractAddress string      `json:"contract_address"` // 合约地址
 	ChainID         string      `json:"chain_id"`         // 链ID
+
+	// 以下字段只在合并多个来源时填写，不参与JSON编解码
+	Sources    []string          `json:"-"` // 提供该空投的来源，按优先级排列
+	Provenance map[string]string `json:"-"` // 字段名 -> 实际取值的来源
+	Conflicts  []string          `json:"-"` // 来源之间取值不一致的字段说明
+
+	Snoozed bool `json:"-"` // 被覆盖文件暂停了开始前提醒
+}
+
+// pointsString 将Points字段转换为字符串
+// 接口返回的积分可能是字符串或数字
+func pointsString(points interface{}) string {
+	switch p := points.(type) {
+	case nil:
+		return ""
+	case string:
+		return p
+	case float64:
+		return fmt.Sprintf("%.0f", p)
+	case int:
+		return fmt.Sprintf("%d", p)
+	default:
+		return fmt.Sprintf("%v", p)
+	}
+}
+
+// parseAmount 解析空投数量，允许小数和千位分隔符，如"1,500"、"1.5"
+// 消息、归档和统计计算估值时都使用该函数，保证同一空投的估值一致
+// 参数:
+//   - amount: 上游的数量字符串
+// 返回:
+//   - float64: 数量
+//   - bool: 是否为有效的非负数，为空或无法解析时返回false
+func parseAmount(amount string) (float64, bool) {
+	amount = strings.ReplaceAll(strings.TrimSpace(amount), ",", "")
+	if amount == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(amount, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, false
+	}
+	return n, true
 }
 
 // ApiResponse API响应结构体，包含空投列表
@@ -41,18 +88,53 @@ type ApiResponse struct {
 // SnapshotItem 快照项结构体，用于存储空投信息的简化版本
 // 用于生成和比较快照，只保留关键信息
 type SnapshotItem struct {
-	Token  string // 代币符号
-	Name   string // 项目名称
-	Date   string // 空投日期
-	Time   string // 空投时间
-	Amount string // 空投数量
-	Phase  int    // 空投阶段
+	Token  string `json:"token"`  // 代币符号
+	Name   string `json:"name"`   // 项目名称
+	Date   string `json:"date"`   // 空投日期
+	Time   string `json:"time"`   // 空投时间
+	Amount string `json:"amount"` // 空投数量
+	Phase  int    `json:"phase"`  // 空投阶段
+}
+
+// PricedAirdrop 带价格的空投，即消息表格中的一行
+type PricedAirdrop struct {
+	Airdrop
+	Price          float64 `json:"price"`          // 代币价格（USD），查询失败时为0
+	Value          float64 `json:"value"`          // 价格乘以数量
+	PriceAvailable bool    `json:"priceAvailable"` // 是否查到了价格
+	ValuePerPoint  float64 `json:"valuePerPoint"`  // 估值除以所需积分，没有价格或积分时为0
+	Rank           int     `json:"rank,omitempty"` // 按每分价值在当前窗口内的排名，从1开始，没有每分价值时为0
+
+	StartsAt *time.Time `json:"startsAt,omitempty"` // 开始时间（带时区），日期无法解析时为空
+	Snoozed  bool       `json:"snoozed,omitempty"`  // 是否暂停了开始前提醒
+}
+
+// AirdropView 最近一次GenerateMessageAndSnapshot的结果，供本地API读取
+type AirdropView struct {
+	GeneratedAt time.Time       `json:"generatedAt"` // 生成时间
+	Status      DataStatus      `json:"status"`      // 数据来源和新鲜度
+	Upstream    []Airdrop       `json:"upstream"`    // 上游返回的原始列表，未应用覆盖和过滤
+	Airdrops    []PricedAirdrop `json:"airdrops"`    // 过滤后带价格的空投，顺序与消息一致
+
+	PriceSuspended bool `json:"priceSuspended"` // 价格接口是否处于熔断，熔断时价值列不可用
 }
 
 // AirdropService 空投服务，提供空投数据处理的核心功能
 // 包括获取数据、生成消息、比较快照等
 type AirdropService struct {
-	config *Config // 配置信息，包含SendKey、检查间隔等
+	config       *Config           // 配置信息，包含SendKey、检查间隔等
+	priceBreaker *CircuitBreaker   // 价格接口熔断器，连续403/5xx后暂停查价
+	lastStatus   DataStatus        // 最近一次生成消息所用数据的来源和新鲜度
+	quarantined  []SanityIssue     // 最近一次请求被隔离的原因，未隔离时为空
+	schemaReport *SchemaReport     // 本周期JSON接口响应的结构检查结果，未获取到响应时为nil
+	lastAirdrops []Airdrop         // 最近一次生成消息时使用的空投，顺序与消息一致
+	transport    http.RoundTripper // 上游请求使用的Transport，录制或回放时替换，nil表示默认
+	replayClock  time.Time         // 回放模式下固定的"当前时间"，非回放时为零值
+
+	viewMu sync.RWMutex // 保护view，检查周期写入、HTTP请求读取
+	view   AirdropView  // 最近一次生成的结果
+
+	checkRequests chan struct{} // 看板等发起的立即检查请求，daemon循环读取
 }
 
 // NewAirdropService 创建空投服务实例
@@ -61,35 +143,88 @@ type AirdropService struct {
 // 返回:
 //   - *AirdropService: 空投服务实例
 func NewAirdropService(config *Config) *AirdropService {
-	return &AirdropService{
-		config: config,
+	s := &AirdropService{
+		config:        config,
+		checkRequests: make(chan struct{}, 1),
+	}
+	if config == nil || s.replaying() {
+		// 回放时熔断器不受本机状态影响，也不改写它
+		s.priceBreaker = NewCircuitBreaker(config.PriceBreakerConfig())
+	} else {
+		s.priceBreaker = LoadCircuitBreaker(config.PriceBreakerConfig(), config.StatePath(priceBreakerFile))
+	}
+	transport, clock, err := newCaptureTransport(config)
+	if err != nil {
+		// 回放文件不可用时不能悄悄访问真实网络，所有请求直接返回该错误
+		slog.Error("初始化录制回放失败", LogKeyError, err)
+		transport = failingTransport{err: err}
+	}
+	s.transport = transport
+	s.replayClock = clock
+	return s
+}
+
+// now 返回当前时间，回放模式下返回录制开始的时间，使日期过滤与录制时一致
+func (s *AirdropService) now() time.Time {
+	if !s.replayClock.IsZero() {
+		return s.replayClock
 	}
+	return time.Now()
+}
+
+// replaying 判断是否处于回放模式，回放时不写入缓存、隔离和结构检查等状态文件
+func (s *AirdropService) replaying() bool {
+	return s.config != nil && s.config.Capture.Mode == CaptureReplay
 }
 
 // GetAirdropData 获取空投数据
-// 该方法从API获取最新的空投信息，包含重试机制和错误处理
+// 该方法从API获取最新的空投信息，按配置的重试策略进行重试
+// 参数:
+//   - ctx: 控制取消的上下文，取消后立即停止请求和重试等待
 // 返回:
 //   - *ApiResponse: 包含空投列表的API响应，如果获取失败则返回nil
-func (s *AirdropService) GetAirdropData() *ApiResponse {
+//   - *SchemaReport: 最后一次解析成功的响应的结构检查结果，响应被隔离时也返回，没有可解析的响应时为nil
+//     该方法不保存结构检查结果，告警发出后由调用方通过RecordSchemaReport保存
+func (s *AirdropService) GetAirdropData(ctx context.Context) (*ApiResponse, *SchemaReport) {
 	// 使用当前时间戳作为URL参数避免缓存
 	url := fmt.Sprintf("https://alpha123.uk/api/data?t=%d&fresh=1", time.Now().UnixMilli())
 
-	fmt.Println("开始请求API数据:", url)
-	fmt.Println("注意：已更新请求头以解决403权限问题")
+	logger := Logger(ctx).With(LogKeySource, SourceAPI)
+	logger.Info("开始请求API数据", LogKeyURL, url)
 
-	// 重试机制，最多尝试3次
-	var apiResp ApiResponse
-	var success bool
-	
-	for attempt := 1; attempt <= 3; attempt++ {
-		fmt.Printf("尝试第 %d 次请求...\n", attempt)
-		log.Printf("请求地址: %s", url)
+	s.quarantined = nil
+
+	// 重试策略：指数退避加抖动，尝试次数由配置决定
+	policy := s.config.RetryPolicyFor(EndpointData)
+
+	// retry 在非最后一次尝试失败后等待，返回false表示应停止重试
+	retry := func(attempt int, resp *http.Response) bool {
+		if attempt >= policy.MaxAttempts {
+			return false
+		}
+		delay, err := policy.Wait(ctx, attempt, resp)
+		if err != nil {
+			logger.Warn("等待重试时被取消", LogKeyAttempt, attempt, LogKeyError, err)
+			return false
+		}
+		logger.Info("准备重试", LogKeyAttempt, attempt, LogKeyDelay, delay.Round(time.Millisecond).String())
+		return true
+	}
+
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		// 周期超时或程序退出时不再发起新的请求
+		if ctx.Err() != nil {
+			logger.Warn("请求已取消", LogKeyError, ctx.Err())
+			return nil, nil
+		}
+
+		logger.Debug("发送请求", LogKeyAttempt, attempt, "max_attempts", policy.MaxAttempts)
 
 		// 创建HTTP请求
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
-			log.Println(err) // 记录错误但继续尝试
-			continue
+			logger.Error("构造请求失败", LogKeyError, err) // 请求构造失败，重试也无济于事
+			return nil, nil
 		}
 
 		// 设置更完整的浏览器请求头，模拟真实浏览器请求
@@ -98,12 +233,10 @@ func (s *AirdropService) GetAirdropData() *ApiResponse {
 		req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9") // 语言偏好
 		req.Header.Set("Accept-Encoding", "gzip, deflate, br, zstd") // 支持的压缩方式
 		req.Header.Set("Connection", "keep-alive") // 保持连接
-		// 优先使用环境变量中的Cookie，如果不存在则使用硬编码的Cookie
-		cfCookie := os.Getenv("CF_COOKIE")
-		if cfCookie == "" {
-			cfCookie = "cf_clearance=hSIJzCVzlELiNe.dlq.v_DpVOe0pRvCd.T.dDcJiqWo-1757240233-1.2.1.1-jACMaDCQ6yI674vllyyo_nPGju.lKEFR30kZzM.QqmeHB6jsmFNq1i06w4_sk_1Rf42O2X8uhaVhAeHw6tuXzShLMfTP8Rlpcm3WMZJmNdTvsYli_aCiRfCdahamu_x8_8iSRz9mJvkoPnXCa6yYtAq9xa8ZiN75iF_arLJkfNLFSx2758yD1Pchgth9fjPQzsy0pzsGACAQ8bghvPvA3MT7oiBh2oR9Pq1OFvXHPw0; _clck=1r58hy1%5E2%5Efz4%5E0%5E2023; _clsk=10xp6jp%5E1757240255468%5E2%5E1%5Es.clarity.ms%2Fcollect"
+		// Cookie从环境变量或密钥文件读取，未配置时不发送
+		if cfCookie := s.config.UpstreamCookie(); cfCookie != "" {
+			req.Header.Set("Cookie", cfCookie) // CloudFlare验证Cookie
 		}
-		req.Header.Set("Cookie", cfCookie) // CloudFlare验证Cookie
 		req.Header.Set("If-Modified-Since", "Sun, 07 Sep 2025 10:16:15 GMT") // 条件请求
 		req.Header.Set("If-None-Match", "W/\"68bd5b6f-ce9\"") // ETag条件请求
 		req.Header.Set("Priority", "u=1, i") // 请求优先级
@@ -124,127 +257,136 @@ func (s *AirdropService) GetAirdropData() *ApiResponse {
 		// 设置HTTP客户端，包括30秒超时时间
 		// 超时设置可以防止请求长时间挂起
 		client := &http.Client{
-			Timeout: 30 * time.Second, // 30秒超时，避免请求长时间挂起
+			Timeout:   30 * time.Second,                                // 30秒超时，避免请求长时间挂起
+			Transport: instrumentTransport(s.transport, EndpointData), // 统计耗时和状态码，录制或回放时使用对应的Transport
 		}
 
 		// 执行HTTP请求
-		fmt.Println("发送请求中...")
+		start := time.Now()
 		resp, err := client.Do(req)
 		if err != nil {
-			log.Printf("请求失败 (尝试 %d/3): %v\n", attempt, err)
-			if attempt < 3 { // 如果不是最后一次尝试，则延迟后重试
-				// 随机延迟 2-5 秒后重试，延迟时间随尝试次数增加
-				delay := time.Duration(2+attempt) * time.Second
-				fmt.Printf("等待 %v 后重试...\n", delay)
-				time.Sleep(delay)
+			logger.Warn("请求失败", LogKeyAttempt, attempt, LogKeyError, err)
+			if !retry(attempt, nil) {
+				break
 			}
 			continue // 继续下一次尝试
 		}
-		defer resp.Body.Close() // 确保响应体被关闭
 
 		// 读取响应体，处理可能的gzip压缩
 		body, err := readResponseBody(resp)
+		resp.Body.Close()
 		if err != nil {
-			log.Printf("读取响应体失败 (尝试 %d/3): %v\n", attempt, err)
-			if attempt < 3 {
-				delay := time.Duration(2+attempt) * time.Second
-				fmt.Printf("等待 %v 后重试...\n", delay)
-				time.Sleep(delay)
+			logger.Warn("读取响应体失败", LogKeyAttempt, attempt, LogKeyStatus, resp.StatusCode, LogKeyError, err)
+			if !retry(attempt, resp) {
+				break
 			}
 			continue
 		}
 
-		// 打印响应状态码和响应内容用于调试
-		fmt.Printf("HTTP状态码: %d\n", resp.StatusCode)
-		fmt.Printf("响应内容: %s\n", string(body))
-		fmt.Printf("请求返回状态码: %d\n", resp.StatusCode)
+		// 默认只记录状态码和大小，响应内容只在debug级别输出
+		logger.Info("收到响应", LogKeyAttempt, attempt, LogKeyStatus, resp.StatusCode,
+			"bytes", len(body), LogKeyDuration, time.Since(start).Milliseconds())
+		logger.Debug("响应内容", LogKeyAttempt, attempt, "body", truncateForLog(body))
 
 		// 检查HTTP状态码
 		if resp.StatusCode == 403 { // 403表示禁止访问，可能是被反爬虫机制拦截
-			fmt.Printf("遇到403错误，可能被反爬虫拦截 (尝试 %d/3)\n", attempt)
-			if attempt < 3 {
-				// 403错误时延迟更长时间，给服务器更多冷却时间
-				delay := time.Duration(5+attempt*2) * time.Second
-				fmt.Printf("等待 %v 后重试...\n", delay)
-				time.Sleep(delay)
+			logger.Warn("遇到403错误，可能被反爬虫拦截", LogKeyAttempt, attempt, LogKeyStatus, resp.StatusCode)
+			if !retry(attempt, resp) {
+				break
 			}
 			continue
 		}
 
 		// 处理其他非200状态码
 		if resp.StatusCode != 200 { // 200表示请求成功
-			fmt.Printf("API请求失败，状态码: %d (尝试 %d/3)\n", resp.StatusCode, attempt)
-			if attempt < 3 {
-				delay := time.Duration(2+attempt) * time.Second
-				fmt.Printf("等待 %v 后重试...\n", delay)
-				time.Sleep(delay)
+			logger.Warn("API请求失败", LogKeyAttempt, attempt, LogKeyStatus, resp.StatusCode)
+			if !retry(attempt, resp) {
+				break
 			}
 			continue
 		}
 
-		// 解析JSON响应
-		err = json.Unmarshal(body, &apiResp)
+		// 解析JSON响应，同时检查字段结构是否与预期一致
+		apiResp, report, err := decodeApiResponse(body)
 		if err != nil { // JSON解析失败
-			fmt.Printf("解析JSON失败: %v\n", err)
+			logger.Warn("解析JSON失败", LogKeyAttempt, attempt, LogKeyError, err)
+			if !retry(attempt, resp) {
+				break
+			}
 			continue // 尝试下一次请求，而不是直接返回nil
 		}
 
-		// 成功获取数据，处理时间偏移
-		fmt.Printf("成功获取数据，共有 %d 个空投项目\n", len(apiResp.Airdrops))
-		success = true
-		break // 成功获取数据，跳出重试循环
-		// 对于Phase 2的项目，需要将时间加上18小时进行调整
-		// 对于Phase 2的项目，需要将时间加上18小时进行调整
-		// 对于Phase 2的项目，需要将时间加上18小时进行调整
-		for i, item := range apiResp.Airdrops {
-			if item.Phase == 2 && item.Date != "" && item.Time != "" {
-				// 时间加18小时，这是针对特定阶段的时间调整
-				layout := "2006-01-02 15:04" // Go的时间格式化模板
-				parsed, err := time.Parse(layout, item.Date+" "+item.Time)
-				if err == nil {
-					// 时间调整，加18小时
-					parsed = parsed.Add(18 * time.Hour)
-					// 更新日期和时间
-					item.Date = parsed.Format("2006-01-02")
-					item.Time = parsed.Format("15:04")
-				}
-				// 更新切片中的项目
-				apiResp.Airdrops[i] = item
+		logger.Info("成功获取数据", LogKeyAttempt, attempt, LogKeyCount, len(apiResp.Airdrops))
+
+		// 字段结构变化时打印日志，是否需要告警由调用方与保存的结果比较
+		if report.HasDrift() {
+			logger.Warn("上游响应结构与预期不符", "drift", report.Signature())
+		}
+
+		// 与上次被接受的响应比较，可疑的响应隔离起来，不参与快照比较，也不写入缓存
+		if issues := s.checkResponseSanity(ctx, apiResp); len(issues) > 0 {
+			s.quarantined = issues
+			reasons := issueReasons(issues)
+			logger.Warn("响应可疑，已隔离", "reasons", strings.Join(reasons, "; "))
+			if s.replaying() {
+				// 回放时不写入隔离目录
+			} else if path, err := s.quarantineResponse(body, reasons); err != nil {
+				logger.Error("保存隔离响应失败", LogKeyError, err)
+			} else {
+				logger.Info("隔离响应已保存", LogKeyPath, path)
 			}
+			return nil, report
 		}
 
-		fmt.Println("API请求成功！")
-		return &apiResp // 返回成功获取的数据
+		// 缓存原始响应，上游不可用时作为回退数据
+		// 回放的响应不覆盖真实缓存
+		if !s.replaying() {
+			s.clearQuarantineAlert(ctx)
+			if err := SaveResponseCache(s.config.StatePath(responseCacheFile), body, time.Now()); err != nil {
+				logger.Error("保存响应缓存失败", LogKeyError, err)
+			}
+		}
+		return apiResp, report // 返回成功获取的数据
 	}
 
-	// 检查是否成功获取数据
-	if !success {
-		fmt.Println("所有重试都失败，无法获取空投数据")
-		return nil // 返回nil表示获取失败
-	}
-	
-	// 成功获取数据，返回结果
-	fmt.Println("成功返回API数据")
-	return &apiResp
+	logger.Error("所有重试都失败，无法获取空投数据", LogKeyAttempt, policy.MaxAttempts)
+	return nil, nil // 返回nil表示获取失败
+}
+
+// PriceBreakerState 返回价格接口熔断器的当前状态
+// 返回:
+//   - string: BreakerClosed、BreakerOpen或BreakerHalfOpen
+func (s *AirdropService) PriceBreakerState() string {
+	return s.priceBreaker.State()
 }
 
 // FetchTokenPrice 获取token单价
 // 该方法从价格API获取指定代币的当前价格
+// 连续遇到403/5xx时熔断器打开，冷却期内直接返回ErrCircuitOpen而不再请求
 // 参数:
+//   - ctx: 控制取消的上下文，取消后立即停止请求和重试等待
 //   - token: 代币符号，如"ETH"、"BTC"等
 // 返回:
 //   - float64: 代币价格，单位为USD
 //   - error: 错误信息，如果获取成功则为nil
-func (s *AirdropService) FetchTokenPrice(token string) (float64, error) {
+func (s *AirdropService) FetchTokenPrice(ctx context.Context, token string) (float64, error) {
 	// 构建价格API的URL，添加时间戳参数避免缓存
 	url := fmt.Sprintf("https://alpha123.uk/api/price/%s?t=%d&fresh=1", token, time.Now().UnixMilli())
 
-	// 重试机制，最多尝试2次
-	for attempt := 1; attempt <= 2; attempt++ {
-		log.Printf("价格API请求地址: %s", url)
+	policy := s.config.RetryPolicyFor(EndpointPrice)
+
+	var lastErr error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		// 熔断器打开时不再请求价格接口
+		if !s.priceBreaker.Allow() {
+			return 0, ErrCircuitOpen
+		}
+
+		Logger(ctx).Debug("请求价格接口", LogKeyToken, token, LogKeyAttempt, attempt, LogKeyURL, url)
 		// 创建HTTP GET请求
-		req, err := http.NewRequest("GET", url, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
+			s.priceBreaker.Abort()
 			return 0, err // 创建请求失败，直接返回错误
 		}
 
@@ -271,102 +413,154 @@ func (s *AirdropService) FetchTokenPrice(token string) (float64, error) {
 		// 设置HTTP客户端，包括15秒超时时间
 		// 价格API请求超时时间比空投数据API短，因为价格查询应该更快返回
 		client := &http.Client{
-			Timeout: 15 * time.Second, // 15秒超时
+			Timeout:   15 * time.Second,                                 // 15秒超时
+			Transport: instrumentTransport(s.transport, EndpointPrice), // 统计耗时和状态码，录制或回放时使用对应的Transport
 		}
 
 		// 执行HTTP请求
 		resp, err := client.Do(req)
 		if err != nil { // 请求失败
-			if attempt < 2 { // 如果不是最后一次尝试，则延迟后重试
-				time.Sleep(time.Duration(2+attempt) * time.Second)
-				continue
+			s.priceBreaker.Abort() // 没有拿到响应，无法判断接口状态
+			if ctx.Err() != nil {
+				return 0, ctx.Err() // 已取消，不再重试
 			}
-			return 0, err // 所有尝试都失败，返回错误
-		}
-		defer resp.Body.Close() // 确保响应体被关闭
-
-		// 检查HTTP状态码
-		if resp.StatusCode == 403 { // 403表示禁止访问，可能是被反爬虫机制拦截
-			if attempt < 2 {
-				time.Sleep(time.Duration(3+attempt) * time.Second) // 403错误时延迟更长时间
-				continue
+			lastErr = err
+		} else {
+			// 403/5xx计入熔断器，其他响应说明接口可用
+			if isBreakerFailure(resp.StatusCode) {
+				s.priceBreaker.RecordFailure()
+			} else {
+				s.priceBreaker.RecordSuccess()
 			}
-			return 0, fmt.Errorf("price API blocked (403)") // 返回被拦截错误
-		}
 
-		// 处理其他非200状态码
-		if resp.StatusCode != 200 { // 200表示请求成功
-			if attempt < 2 {
-				time.Sleep(time.Duration(2+attempt) * time.Second)
-				continue
+			var price float64
+			price, lastErr = parsePriceResponse(resp)
+			if lastErr == nil {
+				return price, nil // 返回成功获取的价格
 			}
-			return 0, fmt.Errorf("price API failed with status %d", resp.StatusCode) // 返回API失败错误
-		}
-
-		// 读取响应体，处理可能的gzip压缩
-		body, err := readResponseBody(resp)
-		if err != nil { // 读取响应体失败
-			if attempt < 2 {
-				time.Sleep(time.Duration(2+attempt) * time.Second)
-				continue
+			if errors.Is(lastErr, errPriceUnavailable) {
+				return 0, lastErr // 接口明确表示无价格，重试没有意义
 			}
-			return 0, fmt.Errorf("failed to read response body: %v", err) // 返回读取失败错误
 		}
 
-		// 定义匿名结构体用于解析价格API的JSON响应
-		var result struct {
-			Success bool    `json:"success"` // 是否成功
-			Price   float64 `json:"price"`   // 价格值
-		}
-		
-		// 解析JSON响应
-		if err := json.Unmarshal(body, &result); err != nil { // JSON解析失败
-			if attempt < 2 {
-				time.Sleep(time.Duration(2+attempt) * time.Second)
-				continue
+		if attempt < policy.MaxAttempts {
+			if _, err := policy.Wait(ctx, attempt, resp); err != nil {
+				return 0, err
 			}
-			return 0, fmt.Errorf("failed to parse JSON: %v, body: %s", err, string(body)) // 返回解析失败错误
 		}
-
-		// 检查API返回的成功标志
-		if !result.Success { // API返回失败
-			return 0, fmt.Errorf("price fetch failed") // 返回获取失败错误
-		}
-		return result.Price, nil // 返回成功获取的价格
 	}
 
 	// 所有重试都失败
-	return 0, fmt.Errorf("all price fetch attempts failed")
+	return 0, fmt.Errorf("all price fetch attempts failed: %w", lastErr)
+}
+
+// errPriceUnavailable 价格接口返回success=false，表示该代币暂无价格
+var errPriceUnavailable = errors.New("price fetch failed")
+
+// parsePriceResponse 检查价格接口的响应并解析出价格
+// 参数:
+//   - resp: 价格接口的HTTP响应，函数返回前关闭响应体
+// 返回:
+//   - float64: 代币价格，单位为USD
+//   - error: 状态码异常、读取或解析失败时返回错误
+func parsePriceResponse(resp *http.Response) (float64, error) {
+	defer resp.Body.Close() // 确保响应体被关闭
+
+	// 检查HTTP状态码
+	if resp.StatusCode == 403 { // 403表示禁止访问，可能是被反爬虫机制拦截
+		return 0, fmt.Errorf("price API blocked (403)") // 返回被拦截错误
+	}
+
+	// 处理其他非200状态码
+	if resp.StatusCode != 200 { // 200表示请求成功
+		return 0, fmt.Errorf("price API failed with status %d", resp.StatusCode) // 返回API失败错误
+	}
+
+	// 读取响应体，处理可能的gzip压缩
+	body, err := readResponseBody(resp)
+	if err != nil { // 读取响应体失败
+		return 0, fmt.Errorf("failed to read response body: %v", err) // 返回读取失败错误
+	}
+
+	// 定义匿名结构体用于解析价格API的JSON响应
+	var result struct {
+		Success bool    `json:"success"` // 是否成功
+		Price   float64 `json:"price"`   // 价格值
+	}
+
+	// 解析JSON响应
+	if err := json.Unmarshal(body, &result); err != nil { // JSON解析失败
+		return 0, fmt.Errorf("failed to parse JSON: %v, body: %s", err, truncateForLog(body)) // 返回解析失败错误，响应体截断避免刷屏
+	}
+
+	// 检查API返回的成功标志
+	if !result.Success { // API返回失败
+		return 0, errPriceUnavailable // 返回获取失败错误
+	}
+	return result.Price, nil
 }
 
 // GenerateMessageAndSnapshot 生成消息和快照
 // 该方法获取空投数据，过滤符合条件的项目，并生成消息和快照
+// 参数:
+//   - ctx: 控制取消的上下文，数据获取和价格查询都使用该上下文
 // 返回:
 //   - string: 格式化的消息内容，用于推送通知
 //   - string: 当前空投信息的快照，用于与上次快照比较检测变化
-func (s *AirdropService) GenerateMessageAndSnapshot() (string, string) {
+func (s *AirdropService) GenerateMessageAndSnapshot(ctx context.Context) (string, string) {
 	// 打印当前日期，便于日志跟踪
-	fmt.Printf("今日日期: %s\n", time.Now().Format("2006-01-02"))
-
-	// 获取空投数据
-	apiResp := s.GetAirdropData()
+	logger := Logger(ctx)
+	logger.Info("开始生成消息", "today", s.now().Format("2006-01-02"))
+
+	// 获取空投数据，失败时回退到未超过maxStaleness的缓存
+	// JSON接口失败时先尝试备用来源，全部失败再使用缓存
+	s.lastStatus = DataStatus{}
+	s.lastAirdrops = nil
+	s.schemaReport = nil
+	var upstream []Airdrop
+	var priced []PricedAirdrop
+	priceSuspended := false // 价格接口熔断时，价值列统一为0，在消息末尾加以说明
+	defer func() { s.publishView(upstream, priced, priceSuspended) }()
+
+	apiResp, source := s.fetchAirdrops(ctx)
+	if ctx.Err() == nil {
+		health.recordFetch(apiResp != nil) // 取消导致的失败不计入连续失败
+	}
+	if apiResp != nil {
+		s.lastStatus = DataStatus{Available: true, FetchedAt: s.now(), Source: source}
+	} else if ctx.Err() == nil {
+		var fetchedAt time.Time
+		apiResp, fetchedAt = s.loadStaleAirdropData(ctx)
+		if apiResp != nil {
+			logger.Warn("上游不可用，使用缓存的数据", LogKeySource, SourceCache, "fetched_at", fetchedAt.Format(time.RFC3339))
+			s.lastStatus = DataStatus{Available: true, Stale: true, FetchedAt: fetchedAt, Source: SourceCache}
+		}
+	}
+	if len(s.quarantined) > 0 {
+		s.lastStatus.Quarantined = issueReasons(s.quarantined)
+	}
+	s.lastStatus.SchemaDrift = s.newSchemaDrift()
 	if apiResp == nil { // 如果获取失败，返回空字符串
-		fmt.Println("获取空投数据失败")
+		logger.Error("获取空投数据失败")
 		return "", ""
 	}
+	upstream = apiResp.Airdrops
+
+	// 应用本地覆盖文件：修正上游的错误字段、隐藏或新增项目
+	airdrops := s.applyOverrides(ctx, apiResp.Airdrops, s.lastStatus.Source)
 
 	// 收集符合条件的快照项
 	var snapshotItems []SnapshotItem // 用于生成快照的项目列表
 	var validAirdrops []Airdrop     // 有效的空投项目列表
 
 	// 遍历所有空投项目，筛选符合条件的项目
-	for _, item := range apiResp.Airdrops {
+	for _, item := range airdrops {
 		// 检查日期是否在今天往后3天内
-		today := time.Now()
+		today := s.now()
 		// 解析项目日期
 		itemDate, err := time.Parse("2006-01-02", item.Date)
 		if err != nil {
-			fmt.Printf("解析日期失败: %v\n", err) // 日期格式错误，跳过该项目
+			logger.Warn("解析日期失败", LogKeyToken, item.Token, LogKeyError, err) // 日期格式错误，跳过该项目
 			continue
 		}
 
@@ -382,7 +576,7 @@ func (s *AirdropService) GenerateMessageAndSnapshot() (string, string) {
 
 		// 如果配置了过滤TGE类型的项目，且当前项目是TGE类型，则跳过
 		if s.config.FiterTge && item.Type == "tge" {
-			fmt.Printf("过滤TGE: %+v\n", item) // 记录被过滤的TGE项目
+			logger.Debug("过滤TGE", LogKeyToken, item.Token, "phase", item.Phase) // 记录被过滤的TGE项目
 			continue
 		}
 
@@ -399,6 +593,8 @@ func (s *AirdropService) GenerateMessageAndSnapshot() (string, string) {
 		validAirdrops = append(validAirdrops, item)
 	}
 
+	airdropsInWindow.Set(float64(len(snapshotItems)))
+
 	// 如果没有符合条件的项目，返回空字符串
 	if len(snapshotItems) == 0 {
 		return "", ""
@@ -407,11 +603,7 @@ func (s *AirdropService) GenerateMessageAndSnapshot() (string, string) {
 	// 对快照项进行排序（按时间和代币名称）
 	s.sortSnapshotItems(snapshotItems)
 
-	// 生成消息和快照
-	// 使用Markdown表格格式生成消息内容
-	msg := "| 项目 | 时间 | 积分 | 数量 | 阶段 | 价格(USD) |\n|---|---|---|---|---|---|\n"
-
-	// 遍历排序后的快照项，生成消息内容
+	// 遍历排序后的快照项，查询价格
 	for _, snapshotItem := range snapshotItems {
 		// 找到对应的airdrop项目来获取价格信息和积分等详细信息
 		var correspondingAirdrop *Airdrop
@@ -429,58 +621,170 @@ func (s *AirdropService) GenerateMessageAndSnapshot() (string, string) {
 			continue
 		}
 
-		// 解析空投数量为整数，用于计算价值
-		var amount int
-		if snapshotItem.Amount == "" { // 如果数量为空，设为0
-			amount = 0
-		} else {
-			var err error
-			// 将字符串数量转换为整数
-			amount, err = strconv.Atoi(snapshotItem.Amount)
-			if err != nil {
-				fmt.Printf("转换数量失败: %v\n", err)
-				amount = 0 // 转换失败时设为0
-			}
+		// 解析空投数量，用于计算价值
+		amount, ok := parseAmount(snapshotItem.Amount)
+		if !ok && snapshotItem.Amount != "" { // 数量为空时不打印
+			logger.Warn("转换数量失败", LogKeyToken, snapshotItem.Token, "amount", snapshotItem.Amount)
 		}
 
 		// 获取代币价格
-		price, err := s.FetchTokenPrice(snapshotItem.Token)
-		if err != nil {
-			fmt.Printf("获取%s价格失败: %v\n", snapshotItem.Token, err)
+		price, err := s.FetchTokenPrice(ctx, snapshotItem.Token)
+		recordPriceLookup(err)
+		if errors.Is(err, ErrCircuitOpen) {
+			priceSuspended = true // 熔断期间不再逐个打印失败
+			price = 0
+		} else if err != nil {
+			logger.Warn("获取价格失败", LogKeyToken, snapshotItem.Token, LogKeyError, err)
 			price = 0 // 获取价格失败时设为0
 		}
 
+		priced = append(priced, PricedAirdrop{
+			Airdrop:        *correspondingAirdrop,
+			Price:          price,
+			Value:          price * amount,
+			PriceAvailable: err == nil,
+			StartsAt:       s.StartTime(correspondingAirdrop.Date, correspondingAirdrop.Time),
+			Snoozed:        correspondingAirdrop.Snoozed,
+		})
+	}
+
+	if priceSuspended {
+		logger.Warn("价格接口熔断，本次跳过查价", LogKeyStatus, s.PriceBreakerState())
+	}
+
+	// 计算每分价值和排名，按message.sort重新排列，消息和LastAirdrops使用同样的顺序
+	rankAirdrops(priced)
+	sortAirdrops(priced, s.config.Message.sortOrder(ctx))
+	for _, a := range priced {
+		s.lastAirdrops = append(s.lastAirdrops, a.Airdrop)
+	}
+
+	// 使用Markdown表格格式生成消息内容，所有接收人共用，不含资格列
+	msg := renderMessage(s.lastStatus, priced, priceSuspended, nil)
+
+	// 生成排序后的快照字符串，用于保存和比较
+	snapshot := s.itemsToSnapshot(snapshotItems)
+
+	return msg, snapshot // 返回消息内容和快照字符串
+}
+
+// renderMessage 生成推送消息的Markdown表格
+// 参数:
+//   - status: 数据来源和新鲜度，过期数据在消息开头标注
+//   - airdrops: 表格中的空投，按给定顺序输出
+//   - priceSuspended: 价格接口是否熔断，熔断时在消息末尾说明
+//   - balance: 接收人的积分，不为nil时增加资格列
+// 返回:
+//   - string: 消息内容
+func renderMessage(status DataStatus, airdrops []PricedAirdrop, priceSuspended bool, balance *int) string {
+	msg := "| 项目 | 时间 | 积分 | 数量 | 阶段 | 估值(USD) | 每分价值 | 排名 |\n|---|---|---|---|---|---|---|---|\n"
+	if balance != nil {
+		msg = fmt.Sprintf("你的积分：%d\n\n| 项目 | 时间 | 积分 | 资格 | 数量 | 阶段 | 估值(USD) | 每分价值 | 排名 |\n|---|---|---|---|---|---|---|---|---|\n", *balance)
+	}
+
+	// 过期数据在消息开头明确标注
+	if status.Stale {
+		msg = fmt.Sprintf("> 上游暂不可用，以下为 %s 缓存的数据，可能已过期\n\n",
+			status.FetchedAt.Format("2006-01-02 15:04")) + msg
+	}
+
+	for _, a := range airdrops {
 		// 如果type是tge，在名字后面加上(tge)标识
-		projectName := snapshotItem.Name
-		if correspondingAirdrop.Type == "tge" {
+		projectName := a.Name
+		if a.Type == "tge" {
 			projectName += "(tge)"
 		}
+		// 多个来源对时间或数量有分歧时加上标记，详情见preview输出
+		if len(a.Conflicts) > 0 {
+			projectName += " ⚠"
+		}
 
-		// 格式化消息行，添加到消息内容中
-		// 包含：代币符号、项目名称、日期、时间、积分、数量、阶段和价值(USD)
-		
-		// 处理Points字段，将interface{}转换为字符串
-		var pointsStr string
-		switch p := correspondingAirdrop.Points.(type) {
-		case string:
-			pointsStr = p
-		case float64:
-			pointsStr = fmt.Sprintf("%.0f", p)
-		case int:
-			pointsStr = fmt.Sprintf("%d", p)
-		default:
-			pointsStr = fmt.Sprintf("%v", p)
+		// 包含：代币符号、项目名称、日期、时间、积分、数量、阶段、估值(USD)、每分价值和排名
+		points := pointsString(a.Points)
+		if balance != nil {
+			points += " | " + eligibilityMark(points, *balance)
+		}
+		perPoint, rank := "-", "-"
+		if a.Rank > 0 {
+			perPoint, rank = fmt.Sprintf("%.2f", a.ValuePerPoint), fmt.Sprintf("%d", a.Rank)
 		}
-		
-		msg += fmt.Sprintf("| %s(%s) | %s %s | %s | %s | %d | %.2f |\n",
-			snapshotItem.Token, projectName, snapshotItem.Date, snapshotItem.Time,
-			pointsStr, snapshotItem.Amount, snapshotItem.Phase, price*float64(amount))
+		msg += fmt.Sprintf("| %s(%s) | %s %s | %s | %s | %d | %.2f | %s | %s |\n",
+			a.Token, projectName, a.Date, a.Time, points, a.Amount, a.Phase, a.Value, perPoint, rank)
 	}
 
-	// 生成排序后的快照字符串，用于保存和比较
-	snapshot := s.itemsToSnapshot(snapshotItems)
+	if priceSuspended {
+		msg += "\n> 价格接口连续被拦截，暂停查价，价值列暂不可用\n"
+	}
+	return msg
+}
 
-	return msg, snapshot // 返回消息内容和快照字符串
+// LastAirdrops 返回最近一次GenerateMessageAndSnapshot写入消息的空投，顺序与消息一致
+func (s *AirdropService) LastAirdrops() []Airdrop {
+	return s.lastAirdrops
+}
+
+// publishView 保存本次生成的结果，供本地API读取
+func (s *AirdropService) publishView(upstream []Airdrop, priced []PricedAirdrop, priceSuspended bool) {
+	s.viewMu.Lock()
+	defer s.viewMu.Unlock()
+	s.view = AirdropView{
+		GeneratedAt:    s.now(),
+		Status:         s.lastStatus,
+		Upstream:       upstream,
+		Airdrops:       priced,
+		PriceSuspended: priceSuspended,
+	}
+}
+
+// View 返回最近一次GenerateMessageAndSnapshot的结果，可以在其他goroutine中调用
+// 返回:
+//   - AirdropView: 最近一次的结果，尚未运行过时为零值
+func (s *AirdropService) View() AirdropView {
+	s.viewMu.RLock()
+	defer s.viewMu.RUnlock()
+	return s.view
+}
+
+// Message 按该结果生成不含资格列的通用消息，与当时GenerateMessageAndSnapshot返回的消息相同
+// 返回:
+//   - string: 消息内容，窗口内没有空投或未能获取数据时为空字符串
+func (v AirdropView) Message() string {
+	if len(v.Airdrops) == 0 {
+		return ""
+	}
+	return renderMessage(v.Status, v.Airdrops, v.PriceSuspended, nil)
+}
+
+// RequestCheck 请求daemon立即执行一次检查，已有未处理的请求时合并为一次
+// 返回:
+//   - bool: 是否新增了请求，false表示已有请求在排队
+func (s *AirdropService) RequestCheck() bool {
+	select {
+	case s.checkRequests <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// CheckRequests 返回立即检查请求的通道，供daemon循环在等待间隔时读取
+func (s *AirdropService) CheckRequests() <-chan struct{} {
+	return s.checkRequests
+}
+
+// StartTime 返回空投在配置时区下的开始时间
+// 参数:
+//   - date: 日期字符串，格式为"2006-01-02"
+//   - timeStr: 时间字符串，格式为"15:04"，为空时取当天0点
+// 返回:
+//   - *time.Time: 开始时间，日期无法解析时为nil
+func (s *AirdropService) StartTime(date, timeStr string) *time.Time {
+	t := s.parseDateTime(date, timeStr)
+	if t.IsZero() {
+		return nil
+	}
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, s.config.Location())
+	return &t
 }
 
 // parseSnapshot 解析快照字符串为结构体切片
@@ -688,3 +992,12 @@ func (s *AirdropService) DetectSnapshotChange(oldSnapshot, newSnapshot string) (
 
 	return hasAddition, isOnlyDeletion
 }
+
+// 快照变化的类型，用于changes_total指标和变化事件
+const (
+	ChangeAdded       = "added"       // 新增的空投
+	ChangeRemoved     = "removed"     // 消失的空投
+	ChangeRescheduled = "rescheduled" // 日期或时间变化
+	ChangeUpdated     = "updated"     // 名称或数量等其他字段变化
+	ChangePoints      = "points"      // 所需积分变化，不影响快照
+)
@@ -0,0 +1,190 @@
+// Package internal 包含项目的核心功能实现
+// 该文件实现daemon的只读JSON接口，输出与推送消息相同的规范化数据，
+// 内部看板和脚本可以直接使用，不必自己抓取上游
+package internal
+
+import (
+	"encoding/json" // 用于输出JSON
+	"net/http"      // 用于HTTP处理器
+	"os"            // 用于读取快照文件
+	"strconv"       // 用于解析limit参数
+	"time"          // 用于时间字段
+)
+
+// 历史接口limit参数的默认值和上限
+const (
+	defaultAPILimit = 50
+	maxAPILimit     = maxHistoryRecords
+)
+
+// API 本地只读JSON接口
+type API struct {
+	config  *Config
+	service *AirdropService
+}
+
+// NewAPI 创建本地API
+// 参数:
+//   - config: 配置信息，用于定位快照和历史文件
+//   - service: daemon使用的空投服务，提供最近一次检查的结果
+// 返回:
+//   - *API: 本地API实例
+func NewAPI(config *Config, service *AirdropService) *API {
+	return &API{config: config, service: service}
+}
+
+// Register 在路由上注册/api/下的接口
+// 参数:
+//   - mux: 本地HTTP服务的路由
+func (a *API) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/airdrops", readOnly(a.airdrops))
+	mux.HandleFunc("/api/upstream", readOnly(a.upstream))
+	mux.HandleFunc("/api/snapshot", readOnly(a.snapshot))
+	mux.HandleFunc("/api/events", readOnly(a.events))
+	mux.HandleFunc("/api/deliveries", readOnly(a.deliveries))
+	mux.HandleFunc("/api/points", readOnly(a.points))
+}
+
+// readOnly 只允许GET和HEAD请求
+func readOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			writeJSONError(w, http.StatusMethodNotAllowed, "只支持GET请求")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// writeJSON 以JSON输出v
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// writeJSONError 以{"error": msg}输出错误
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
+
+// parseLimit 解析limit参数，缺省为defaultAPILimit，超过maxAPILimit时截断
+func parseLimit(r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultAPILimit, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	if n > maxAPILimit {
+		n = maxAPILimit
+	}
+	return n, true
+}
+
+// airdrops 输出过滤后带价格的空投，即推送消息中的内容
+func (a *API) airdrops(w http.ResponseWriter, _ *http.Request) {
+	view := a.service.View()
+	writeJSON(w, http.StatusOK, struct {
+		GeneratedAt time.Time       `json:"generatedAt"`
+		Status      DataStatus      `json:"status"`
+		Airdrops    []PricedAirdrop `json:"airdrops"`
+	}{view.GeneratedAt, view.Status, nonNil(view.Airdrops)})
+}
+
+// upstream 输出上游返回的原始列表
+func (a *API) upstream(w http.ResponseWriter, _ *http.Request) {
+	view := a.service.View()
+	writeJSON(w, http.StatusOK, struct {
+		GeneratedAt time.Time  `json:"generatedAt"`
+		Status      DataStatus `json:"status"`
+		Airdrops    []Airdrop  `json:"airdrops"`
+	}{view.GeneratedAt, view.Status, nonNil(view.Upstream)})
+}
+
+// snapshot 输出保存的快照，即上次推送或更新时的空投列表
+func (a *API) snapshot(w http.ResponseWriter, _ *http.Request) {
+	path := a.config.StatePath(SnapshotFile)
+	content, err := LoadLastSnapshot(path)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "读取快照失败")
+		return
+	}
+	var updatedAt *time.Time
+	if info, err := os.Stat(path); err == nil {
+		t := info.ModTime()
+		updatedAt = &t
+	}
+	writeJSON(w, http.StatusOK, struct {
+		UpdatedAt *time.Time     `json:"updatedAt,omitempty"`
+		Items     []SnapshotItem `json:"items"`
+	}{updatedAt, nonNil(a.service.parseSnapshot(content))})
+}
+
+// events 输出最近的变化事件，最新的在前
+func (a *API) events(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "limit必须是正整数")
+		return
+	}
+	events, err := LoadChangeEvents(a.config, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "读取变化事件失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Events []ChangeEvent `json:"events"`
+	}{newestFirst(events)})
+}
+
+// deliveries 输出最近的推送记录，最新的在前
+func (a *API) deliveries(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseLimit(r)
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "limit必须是正整数")
+		return
+	}
+	deliveries, err := LoadDeliveries(a.config, limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "读取推送记录失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Deliveries []Delivery `json:"deliveries"`
+	}{newestFirst(deliveries)})
+}
+
+// points 输出各空投所需积分的变化记录
+func (a *API) points(w http.ResponseWriter, _ *http.Request) {
+	history, err := LoadPointsHistory(a.config)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "读取积分记录失败")
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Points PointsHistory `json:"points"`
+	}{history})
+}
+
+// nonNil 把nil切片换成空切片，使JSON输出[]而不是null
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// newestFirst 返回倒序的副本
+func newestFirst[T any](s []T) []T {
+	out := make([]T, len(s))
+	for i, v := range s {
+		out[len(s)-1-i] = v
+	}
+	return out
+}
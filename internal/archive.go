@@ -0,0 +1,259 @@
+// Package internal 包含项目的核心功能实现
+// 该文件把观察到的每个空投归档到状态目录的嵌入式数据库（bbolt）中，
+// 记录字段的每次修订和查到的价格，空投离开窗口后仍可查询，用于事后评估哪些空投值得参与
+package internal
+
+import (
+	"context"       // 用于日志
+	"encoding/json" // 用于记录的编解码
+	"fmt"           // 用于格式化
+	"os"            // 用于检查数据库是否存在
+	"sort"          // 用于排列查询结果
+	"strings"       // 用于比较代币
+	"time"          // 用于时间处理
+
+	bolt "go.etcd.io/bbolt" // 嵌入式键值数据库
+)
+
+// archiveFile 归档数据库文件名，位于状态目录下
+const archiveFile = "archive.db"
+
+// archiveBucket 归档记录所在的bucket
+var archiveBucket = []byte("airdrops")
+
+// maxArchivePrices 每个空投最多保留的价格记录，超过时丢弃最早的
+const maxArchivePrices = 500
+
+// archiveOpenTimeout 数据库被其他进程占用时等待的时间
+const archiveOpenTimeout = 5 * time.Second
+
+// ArchiveRevision 空投字段的一次修订
+type ArchiveRevision struct {
+	At     time.Time `json:"at"`     // 观察到该修订的时间
+	Name   string    `json:"name"`   // 项目名称
+	Date   string    `json:"date"`   // 空投日期
+	Time   string    `json:"time"`   // 空投时间
+	Points string    `json:"points"` // 所需积分
+	Amount string    `json:"amount"` // 空投数量
+	Type   string    `json:"type"`   // 空投类型
+	Status string    `json:"status"` // 空投状态
+}
+
+// sameFields 判断两次修订的字段是否相同，不比较时间
+func (r ArchiveRevision) sameFields(o ArchiveRevision) bool {
+	o.At = r.At
+	return r == o
+}
+
+// ArchivePrice 某个时刻查到的代币价格
+type ArchivePrice struct {
+	At    time.Time `json:"at"`    // 查询时间
+	Price float64   `json:"price"` // 价格（USD）
+}
+
+// ArchiveRecord 一个空投的归档记录，按代币和阶段区分
+type ArchiveRecord struct {
+	Token     string            `json:"token"`     // 代币符号
+	Phase     int               `json:"phase"`     // 空投阶段
+	FirstSeen time.Time         `json:"firstSeen"` // 第一次观察到的时间
+	LastSeen  time.Time         `json:"lastSeen"`  // 最后一次观察到的时间
+	Revisions []ArchiveRevision `json:"revisions"` // 字段修订，最后一条为最新值
+	Prices    []ArchivePrice    `json:"prices"`    // 价格记录，只在价格变化时追加
+}
+
+// Current 返回最新的字段值
+func (r ArchiveRecord) Current() ArchiveRevision {
+	if len(r.Revisions) == 0 {
+		return ArchiveRevision{}
+	}
+	return r.Revisions[len(r.Revisions)-1]
+}
+
+// LastPrice 返回最后一次查到的价格，没有价格记录时返回false
+func (r ArchiveRecord) LastPrice() (float64, bool) {
+	if len(r.Prices) == 0 {
+		return 0, false
+	}
+	return r.Prices[len(r.Prices)-1].Price, true
+}
+
+// openArchive 打开归档数据库
+func openArchive(cfg *Config, readOnly bool) (*bolt.DB, error) {
+	return bolt.Open(cfg.StatePath(archiveFile), 0644, &bolt.Options{Timeout: archiveOpenTimeout, ReadOnly: readOnly})
+}
+
+// ArchiveAirdrops 把最近一次检查中上游返回的所有空投和查到的价格写入归档
+// 过期数据和回放时不写入；字段与上次相同时只更新最后观察时间
+// 参数:
+//   - ctx: 上下文，用于日志
+func (s *AirdropService) ArchiveAirdrops(ctx context.Context) {
+	view := s.View()
+	if !view.Status.Available || view.Status.Stale || s.replaying() || len(view.Upstream) == 0 {
+		return
+	}
+	logger := Logger(ctx)
+	prices := make(map[string]float64)
+	for _, a := range view.Airdrops {
+		if a.PriceAvailable {
+			prices[pointsKey(a.Token, a.Phase)] = a.Price
+		}
+	}
+
+	db, err := openArchive(s.config, false)
+	if err != nil {
+		logger.Error("打开归档数据库失败", LogKeyError, err)
+		return
+	}
+	defer db.Close()
+
+	now := s.now()
+	revised := 0
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(archiveBucket)
+		if err != nil {
+			return err
+		}
+		for _, a := range view.Upstream {
+			if a.Token == "" {
+				continue
+			}
+			key := pointsKey(a.Token, a.Phase)
+			record := ArchiveRecord{Token: a.Token, Phase: a.Phase, FirstSeen: now}
+			if data := b.Get([]byte(key)); data != nil {
+				if err := json.Unmarshal(data, &record); err != nil {
+					return fmt.Errorf("解析归档记录%s失败: %v", key, err)
+				}
+			}
+			record.LastSeen = now
+
+			rev := ArchiveRevision{At: now, Name: a.Name, Date: a.Date, Time: a.Time,
+				Points: pointsString(a.Points), Amount: a.Amount, Type: a.Type, Status: a.Status}
+			if len(record.Revisions) == 0 || !record.Current().sameFields(rev) {
+				record.Revisions = append(record.Revisions, rev)
+				revised++
+			}
+			if price, ok := prices[key]; ok {
+				if last, ok := record.LastPrice(); !ok || last != price {
+					record.Prices = append(record.Prices, ArchivePrice{At: now, Price: price})
+				}
+				if n := len(record.Prices); n > maxArchivePrices {
+					record.Prices = record.Prices[n-maxArchivePrices:]
+				}
+			}
+
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(key), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Error("写入归档失败", LogKeyError, err)
+		return
+	}
+	logger.Debug("已归档空投", LogKeyCount, len(view.Upstream), "revised", revised)
+}
+
+// ArchiveQuery 归档查询条件，零值表示不限制
+type ArchiveQuery struct {
+	Token string // 代币符号，不区分大小写
+	From  string // 空投日期下限（含），格式为2006-01-02
+	To    string // 空投日期上限（含），格式为2006-01-02
+	Type  string // 空投类型，如airdrop、tge
+	Phase int    // 空投阶段，0表示不限制
+}
+
+// matches 判断记录的最新字段是否满足查询条件
+func (q ArchiveQuery) matches(r ArchiveRecord) bool {
+	cur := r.Current()
+	switch {
+	case q.Token != "" && !strings.EqualFold(q.Token, r.Token):
+		return false
+	case q.From != "" && cur.Date < q.From:
+		return false
+	case q.To != "" && cur.Date > q.To:
+		return false
+	case q.Type != "" && q.Type != cur.Type:
+		return false
+	case q.Phase != 0 && q.Phase != r.Phase:
+		return false
+	}
+	return true
+}
+
+// QueryArchive 按条件查询归档记录
+// 参数:
+//   - cfg: 配置信息，用于定位状态目录
+//   - q: 查询条件
+// 返回:
+//   - []ArchiveRecord: 满足条件的记录，按空投日期、时间和代币排列；数据库不存在时为空
+//   - error: 打开或读取数据库失败时返回错误
+func QueryArchive(cfg *Config, q ArchiveQuery) ([]ArchiveRecord, error) {
+	if _, err := os.Stat(cfg.StatePath(archiveFile)); os.IsNotExist(err) {
+		return nil, nil // 只读模式不会创建数据库
+	}
+	db, err := openArchive(cfg, true)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	var records []ArchiveRecord
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(archiveBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			var r ArchiveRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				return fmt.Errorf("解析归档记录%s失败: %v", k, err)
+			}
+			if q.matches(r) {
+				records = append(records, r)
+			}
+			return nil
+		})
+	})
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i].Current(), records[j].Current()
+		if a.Date != b.Date {
+			return a.Date < b.Date
+		}
+		if a.Time != b.Time {
+			return a.Time < b.Time
+		}
+		return records[i].Token < records[j].Token
+	})
+	return records, err
+}
+
+// ArchiveReport 生成归档记录的Markdown表格，按最后一次查到的价格估值
+// 参数:
+//   - records: 归档记录
+// 返回:
+//   - string: 表格内容
+func ArchiveReport(records []ArchiveRecord) string {
+	msg := "| 项目 | 时间 | 类型 | 阶段 | 积分 | 数量 | 修订 | 最后价格 | 估值(USD) | 每分价值 |\n|---|---|---|---|---|---|---|---|---|---|\n"
+	for _, r := range records {
+		cur := r.Current()
+		lastPrice, value, perPoint := "-", "-", "-"
+		if price, ok := r.LastPrice(); ok {
+			lastPrice = fmt.Sprintf("%.6g", price)
+			if amount, ok := parseAmount(cur.Amount); ok {
+				v := price * amount
+				value = fmt.Sprintf("%.2f", v)
+				if points, ok := parsePoints(cur.Points); ok && points > 0 {
+					perPoint = fmt.Sprintf("%.2f", v/float64(points))
+				}
+			}
+		}
+		msg += fmt.Sprintf("| %s(%s) | %s %s | %s | %d | %s | %s | %d | %s | %s | %s |\n",
+			r.Token, cur.Name, cur.Date, cur.Time, cur.Type, r.Phase, cur.Points, cur.Amount, len(r.Revisions), lastPrice, value, perPoint)
+	}
+	return msg
+}
@@ -0,0 +1,148 @@
+// Package internal 包含项目的核心功能实现
+// 该文件负责缓存最近一次成功的上游响应，在上游不可用时作为过期数据的回退来源
+package internal
+
+import (
+	"context"       // 用于日志中的cycle_id
+	"encoding/json" // 用于缓存文件的编解码
+	"fmt"           // 用于格式化错误
+	"os"            // 用于文件操作
+	"path/filepath" // 用于拼接状态目录路径
+	"time"          // 用于时间处理
+)
+
+// responseCacheFile 上游原始响应缓存文件名，位于状态目录下
+const responseCacheFile = "last_response.json"
+
+// defaultMaxStaleness 未配置maxStaleness时缓存的最长可用时间
+const defaultMaxStaleness = 6 * time.Hour
+
+// defaultStateDir 未配置stateDir时使用的状态目录（相对cmd目录）
+const defaultStateDir = "../data"
+
+// CachedResponse 缓存文件的内容
+// Body保存上游返回的原始JSON，便于后续按当前代码重新解析
+type CachedResponse struct {
+	FetchedAt time.Time       `json:"fetchedAt"` // 获取时间
+	Body      json.RawMessage `json:"body"`      // 上游原始响应体
+}
+
+// DataStatus 描述本次使用的空投数据的来源和新鲜度
+type DataStatus struct {
+	Available bool      `json:"available"` // 是否拿到了数据（实时或缓存）
+	Stale     bool      `json:"stale"`     // 是否来自过期缓存
+	FetchedAt time.Time `json:"fetchedAt"` // 数据的获取时间
+	Source    string    `json:"source"`    // 提供数据的来源：api、html或cache
+
+	Quarantined []string      `json:"quarantined,omitempty"` // 本次上游响应被隔离的原因，为空表示未隔离
+	SchemaDrift *SchemaReport `json:"schemaDrift,omitempty"` // 本次上游响应新出现的结构变化，为nil表示结构未变
+}
+
+// StatePath 返回状态目录下指定文件的路径
+// 参数:
+//   - name: 文件名
+// 返回:
+//   - string: 完整路径
+func (c *Config) StatePath(name string) string {
+	dir := defaultStateDir
+	if c != nil && c.StateDir != "" {
+		dir = c.StateDir
+	}
+	return filepath.Join(dir, name)
+}
+
+// MaxStalenessDuration 返回缓存数据允许的最长时间
+// 返回:
+//   - time.Duration: 最长可用时间，0表示禁用缓存回退
+func (c *Config) MaxStalenessDuration() time.Duration {
+	if c == nil || c.MaxStaleness == 0 {
+		return defaultMaxStaleness
+	}
+	if c.MaxStaleness < 0 {
+		return 0
+	}
+	return time.Duration(c.MaxStaleness) * time.Minute
+}
+
+// SaveResponseCache 保存一次成功的上游响应
+// 先写入临时文件再重命名，避免中途退出时留下损坏的缓存
+// 参数:
+//   - path: 缓存文件路径
+//   - body: 上游原始响应体
+//   - fetchedAt: 获取时间
+// 返回:
+//   - error: 编码或写入失败时返回错误
+func SaveResponseCache(path string, body []byte, fetchedAt time.Time) error {
+	data, err := json.Marshal(CachedResponse{FetchedAt: fetchedAt, Body: body})
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadResponseCache 读取缓存的上游响应
+// 参数:
+//   - path: 缓存文件路径
+// 返回:
+//   - *CachedResponse: 缓存内容，文件不存在时返回nil
+//   - error: 读取或解析失败时返回错误
+func LoadResponseCache(path string) (*CachedResponse, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // 还没有成功获取过数据
+		}
+		return nil, err
+	}
+	var cached CachedResponse
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("解析缓存文件失败: %v", err)
+	}
+	return &cached, nil
+}
+
+// loadStaleAirdropData 从缓存中读取上次成功的空投数据
+// 缓存超过maxStaleness时视为不可用；回放时不读取本机的缓存
+// 参数:
+//   - ctx: 上下文，用于日志中的cycle_id
+// 返回:
+//   - *ApiResponse: 缓存中的空投数据，不可用时返回nil
+//   - time.Time: 缓存的获取时间
+func (s *AirdropService) loadStaleAirdropData(ctx context.Context) (*ApiResponse, time.Time) {
+	logger := Logger(ctx).With(LogKeySource, SourceCache)
+	maxAge := s.config.MaxStalenessDuration()
+	if maxAge == 0 || s.replaying() {
+		return nil, time.Time{} // 已禁用缓存回退，或回放中
+	}
+
+	cached, err := LoadResponseCache(s.config.StatePath(responseCacheFile))
+	if err != nil {
+		logger.Error("读取响应缓存失败", LogKeyError, err)
+		return nil, time.Time{}
+	}
+	if cached == nil {
+		return nil, time.Time{}
+	}
+
+	if age := s.now().Sub(cached.FetchedAt); age > maxAge {
+		logger.Warn("响应缓存已过期，不再使用", "age", age.Round(time.Minute).String(), "max_age", maxAge.String())
+		return nil, time.Time{}
+	}
+
+	apiResp, _, err := decodeApiResponse(cached.Body)
+	if err != nil {
+		logger.Error("解析缓存的空投数据失败", LogKeyError, err)
+		return nil, time.Time{}
+	}
+	return apiResp, cached.FetchedAt
+}
+
+// LastDataStatus 返回最近一次GenerateMessageAndSnapshot所用数据的状态
+// 调用方据此判断数据是否过期，过期数据不应触发推送或更新快照
+func (s *AirdropService) LastDataStatus() DataStatus {
+	return s.lastStatus
+}
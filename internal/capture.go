@@ -0,0 +1,411 @@
+// Package internal 包含项目的核心功能实现
+// 该文件实现上游流量的录制与回放：录制模式把每次请求和响应连同所属的cycle_id写入JSONL文件，
+// 回放模式从文件中选出一个检查周期，按顺序返回录制的响应，便于离线复现线上的检查周期
+package internal
+
+import (
+	"bufio"           // 用于逐行读取录制文件
+	"bytes"           // 用于构造响应体
+	"compress/gzip"   // 用于解压录制的响应体
+	"encoding/base64" // 用于保存非文本响应体
+	"encoding/json"   // 用于JSONL编解码
+	"errors"          // 用于定义错误
+	"fmt"             // 用于格式化输出
+	"io"              // 用于读取响应体
+	"log/slog"        // 用于结构化日志
+	"net/http"        // 用于实现RoundTripper
+	"net/url"         // 用于生成匹配键
+	"os"              // 用于文件操作
+	"path/filepath"   // 用于创建录制目录
+	"sort"            // 用于生成稳定的匹配键
+	"strings"         // 用于字符串处理
+	"sync"            // 用于保护并发写入和回放进度
+	"time"            // 用于记录耗时
+	"unicode/utf8"    // 用于判断响应体是否为文本
+)
+
+// 录制模式
+const (
+	CaptureRecord = "record" // 真实请求上游，同时把请求和响应写入文件
+	CaptureReplay = "replay" // 不访问网络，从文件中返回录制的响应
+)
+
+// CaptureConfig 录制回放配置
+type CaptureConfig struct {
+	Mode  string `json:"mode"`  // record、replay，为空表示关闭
+	File  string `json:"file"`  // 录制文件路径；录制模式为空时在状态目录的captures下每个检查周期生成一个文件
+	Cycle string `json:"cycle"` // 回放的检查周期cycle_id，为空时回放文件中的第一个周期
+
+	// Overrides 回放时是否应用本地覆盖文件，默认不应用，使同一录制文件在任何机器上的输出相同
+	Overrides bool `json:"overrides"`
+}
+
+// CaptureEntry 录制文件中的一行，对应一次上游请求
+type CaptureEntry struct {
+	Time            time.Time         `json:"time"`                      // 请求开始时间
+	Cycle           string            `json:"cycle,omitempty"`           // 发起请求的检查周期cycle_id
+	Method          string            `json:"method"`                    // 请求方法
+	URL             string            `json:"url"`                       // 请求地址
+	RequestHeaders  map[string]string `json:"requestHeaders,omitempty"`  // 请求头，敏感字段已脱敏
+	Status          int               `json:"status,omitempty"`          // 响应状态码，请求失败时为0
+	ResponseHeaders map[string]string `json:"responseHeaders,omitempty"` // 响应头，敏感字段已脱敏
+	Body            string            `json:"body,omitempty"`            // 响应体（已解压）
+	BodyBase64      bool              `json:"bodyBase64,omitempty"`      // Body是否为base64编码
+	Error           string            `json:"error,omitempty"`           // 请求失败时的错误
+	DurationMs      int64             `json:"durationMs"`                // 请求耗时（毫秒）
+}
+
+// captureRedactedHeaders 录制时需要脱敏的请求头和响应头
+var captureRedactedHeaders = map[string]bool{
+	"Cookie":        true,
+	"Set-Cookie":    true,
+	"Authorization": true,
+}
+
+// flattenHeaders 把http.Header转换为单值map，并对敏感字段脱敏
+func flattenHeaders(h http.Header) map[string]string {
+	if len(h) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(h))
+	for key, values := range h {
+		if captureRedactedHeaders[http.CanonicalHeaderKey(key)] {
+			out[key] = redactedMask
+			continue
+		}
+		out[key] = Redact(strings.Join(values, ", "))
+	}
+	return out
+}
+
+// captureKey 生成回放时的匹配键：方法+去掉防缓存参数t后的URL
+func captureKey(method, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return method + " " + rawURL
+	}
+	query := u.Query()
+	query.Del("t") // 时间戳参数每次都不同
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		parts = append(parts, k+"="+strings.Join(query[k], ","))
+	}
+	return method + " " + u.Scheme + "://" + u.Host + u.Path + "?" + strings.Join(parts, "&")
+}
+
+// RecordingTransport 录制上游流量的RoundTripper
+type RecordingTransport struct {
+	base http.RoundTripper // 实际发送请求的Transport
+	path string            // 录制文件路径，为空时按检查周期写入dir下的不同文件
+	dir  string            // 按检查周期分文件时的目录
+	mu   sync.Mutex        // 保护文件追加写入和当前周期
+
+	cycle     string // 当前写入的检查周期
+	cyclePath string // 当前检查周期的录制文件
+}
+
+// NewRecordingTransport 创建录制Transport，所有请求写入同一个文件
+// 参数:
+//   - base: 实际发送请求的Transport，为nil时使用http.DefaultTransport
+//   - path: 录制文件路径，每次请求追加一行
+// 返回:
+//   - *RecordingTransport: 录制Transport实例
+func NewRecordingTransport(base http.RoundTripper, path string) *RecordingTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &RecordingTransport{base: base, path: path}
+}
+
+// NewCycleRecordingTransport 创建录制Transport，每个检查周期写入dir下单独的文件
+// daemon长期录制时文件不会无限增长，过期的周期可以直接删除
+// 参数:
+//   - base: 实际发送请求的Transport，为nil时使用http.DefaultTransport
+//   - dir: 录制目录，文件名为capture-时间-cycle_id.jsonl
+// 返回:
+//   - *RecordingTransport: 录制Transport实例
+func NewCycleRecordingTransport(base http.RoundTripper, dir string) *RecordingTransport {
+	t := NewRecordingTransport(base, "")
+	t.dir = dir
+	return t
+}
+
+// RoundTrip 发送请求并录制请求和响应
+// 响应体被完整读出后重新放回，调用方看到的响应与未录制时一致
+func (t *RecordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	entry := CaptureEntry{
+		Time:           start,
+		Cycle:          cycleID(req.Context()),
+		Method:         req.Method,
+		URL:            req.URL.String(),
+		RequestHeaders: flattenHeaders(req.Header),
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		entry.Error = err.Error()
+		entry.DurationMs = time.Since(start).Milliseconds()
+		t.write(entry)
+		return nil, err
+	}
+
+	raw, readErr := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(raw))
+	entry.DurationMs = time.Since(start).Milliseconds()
+	entry.Status = resp.StatusCode
+
+	// 录制文件中保存解压后的内容，回放时不再声明Content-Encoding
+	headers := resp.Header.Clone()
+	body := raw
+	if strings.Contains(headers.Get("Content-Encoding"), "gzip") {
+		if zr, err := gzip.NewReader(bytes.NewReader(raw)); err == nil {
+			if decoded, err := io.ReadAll(zr); err == nil {
+				body = decoded
+				headers.Del("Content-Encoding")
+				headers.Del("Content-Length")
+			}
+		}
+	}
+	entry.ResponseHeaders = flattenHeaders(headers)
+	if utf8.Valid(body) {
+		entry.Body = string(body)
+	} else {
+		entry.Body = base64.StdEncoding.EncodeToString(body)
+		entry.BodyBase64 = true
+	}
+	if readErr != nil {
+		entry.Error = readErr.Error()
+	}
+	t.write(entry)
+	if readErr != nil {
+		return nil, readErr // 响应体不完整，与未录制时读取失败的表现一致
+	}
+	return resp, nil
+}
+
+// write 把一条录制追加到文件，失败只打印不影响请求
+func (t *RecordingTransport) write(entry CaptureEntry) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	path := t.path
+	if path == "" {
+		// 新的检查周期开始时换一个文件
+		if t.cyclePath == "" || entry.Cycle != t.cycle {
+			name := "capture-" + entry.Time.Format("20060102-150405")
+			if entry.Cycle != "" {
+				name += "-" + entry.Cycle
+			}
+			t.cycle, t.cyclePath = entry.Cycle, filepath.Join(t.dir, name+".jsonl")
+		}
+		path = t.cyclePath
+	}
+
+	// 地址、响应体和错误中也可能出现密钥，写入前统一脱敏
+	entry.URL = Redact(entry.URL)
+	entry.Error = Redact(entry.Error)
+	if !entry.BodyBase64 {
+		entry.Body = Redact(entry.Body)
+	}
+	line, err := json.Marshal(entry)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	var f *os.File
+	if err == nil {
+		f, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	}
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		f.Close()
+	}
+	if err != nil {
+		slog.Error("写入录制文件失败", LogKeyPath, path, LogKeyError, err)
+	}
+}
+
+// ErrCaptureExhausted 回放时录制文件中没有更多匹配的请求
+var ErrCaptureExhausted = errors.New("录制文件中没有更多匹配的请求")
+
+// ReplayTransport 从录制文件回放响应的RoundTripper
+// 只回放一个检查周期的录制；同一个请求（方法+URL，忽略t参数）按录制顺序依次返回，重试序列也能原样复现
+type ReplayTransport struct {
+	mu      sync.Mutex
+	entries map[string][]CaptureEntry // 匹配键 -> 尚未回放的录制
+	start   time.Time                 // 所选周期第一条录制的时间
+	cycle   string                    // 所选周期的cycle_id，旧版录制文件没有cycle_id时为空
+	cycles  []string                  // 文件中所有周期的cycle_id，按出现顺序
+}
+
+// LoadReplayTransport 读取录制文件中一个检查周期的录制并创建回放Transport
+// 参数:
+//   - path: JSONL录制文件路径
+//   - cycle: 要回放的cycle_id，为空时选择文件中的第一个周期
+// 返回:
+//   - *ReplayTransport: 回放Transport实例
+//   - error: 读取或解析失败、文件中没有该周期时返回错误
+func LoadReplayTransport(path string, cycle string) (*ReplayTransport, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t := &ReplayTransport{entries: make(map[string][]CaptureEntry)}
+	seen := make(map[string]bool)
+	picked := cycle != ""
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024) // 响应体可能很大
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var entry CaptureEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return nil, fmt.Errorf("%s 第%d行解析失败: %v", path, lineNo, err)
+		}
+		if !seen[entry.Cycle] {
+			seen[entry.Cycle] = true
+			t.cycles = append(t.cycles, entry.Cycle)
+		}
+		if !picked {
+			cycle, picked = entry.Cycle, true // 未指定时选择第一个周期
+		}
+		if entry.Cycle != cycle {
+			continue
+		}
+		if t.start.IsZero() || entry.Time.Before(t.start) {
+			t.start = entry.Time
+		}
+		key := captureKey(entry.Method, entry.URL)
+		t.entries[key] = append(t.entries[key], entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(t.cycles) > 0 && !seen[cycle] {
+		if len(t.cycles) == 1 && t.cycles[0] == "" {
+			return nil, fmt.Errorf("%s 没有记录cycle_id，不能指定检查周期", path)
+		}
+		return nil, fmt.Errorf("%s 中没有检查周期%s，可选: %s", path, cycle, strings.Join(t.cycles, ", "))
+	}
+	t.cycle = cycle
+	return t, nil
+}
+
+// Cycle 返回回放的检查周期cycle_id
+func (t *ReplayTransport) Cycle() string {
+	return t.cycle
+}
+
+// Cycles 返回录制文件中所有检查周期的cycle_id，按录制顺序
+func (t *ReplayTransport) Cycles() []string {
+	return t.cycles
+}
+
+// StartTime 返回录制开始的时间，回放时作为"当前时间"使过滤结果与线上一致
+func (t *ReplayTransport) StartTime() time.Time {
+	return t.start
+}
+
+// RoundTrip 返回下一条匹配的录制响应
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := captureKey(req.Method, req.URL.String())
+
+	t.mu.Lock()
+	queue := t.entries[key]
+	if len(queue) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrCaptureExhausted, key)
+	}
+	entry := queue[0]
+	t.entries[key] = queue[1:]
+	t.mu.Unlock()
+
+	if entry.Status == 0 || entry.Error != "" {
+		return nil, fmt.Errorf("回放录制的错误: %s", entry.Error)
+	}
+
+	body := []byte(entry.Body)
+	if entry.BodyBase64 {
+		decoded, err := base64.StdEncoding.DecodeString(entry.Body)
+		if err != nil {
+			return nil, err
+		}
+		body = decoded
+	}
+	header := make(http.Header)
+	for k, v := range entry.ResponseHeaders {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+		StatusCode:    entry.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// newCaptureTransport 按配置创建录制或回放Transport
+// 参数:
+//   - cfg: 配置信息
+// 返回:
+//   - http.RoundTripper: 录制或回放Transport，未开启时返回nil（使用默认Transport）
+//   - time.Time: 回放模式下录制开始的时间，其他模式为零值
+//   - error: 回放文件读取失败或模式未知时返回错误
+func newCaptureTransport(cfg *Config) (http.RoundTripper, time.Time, error) {
+	if cfg == nil {
+		return nil, time.Time{}, nil
+	}
+	switch cfg.Capture.Mode {
+	case "":
+		return nil, time.Time{}, nil
+	case CaptureRecord:
+		if cfg.Capture.File == "" {
+			dir := cfg.StatePath("captures")
+			slog.Info("录制模式：每个检查周期的上游流量写入单独的文件", LogKeyPath, dir)
+			return NewCycleRecordingTransport(nil, dir), time.Time{}, nil
+		}
+		slog.Info("录制模式：上游流量写入文件", LogKeyPath, cfg.Capture.File)
+		return NewRecordingTransport(nil, cfg.Capture.File), time.Time{}, nil
+	case CaptureReplay:
+		replay, err := LoadReplayTransport(cfg.Capture.File, cfg.Capture.Cycle)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		slog.Info("回放模式：使用录制的响应", LogKeyPath, cfg.Capture.File, LogKeyCycleID, replay.Cycle(),
+			"clock", replay.StartTime().Format(time.RFC3339))
+		if cycles := replay.Cycles(); len(cycles) > 1 {
+			slog.Info("录制文件包含多个检查周期，可用-cycle选择", LogKeyCount, len(cycles), "cycles", strings.Join(cycles, ","))
+		}
+		return replay, replay.StartTime(), nil
+	default:
+		return nil, time.Time{}, fmt.Errorf("未知的录制模式: %s", cfg.Capture.Mode)
+	}
+}
+
+// failingTransport 所有请求都返回同一个错误的Transport
+// 回放文件无法读取时使用，避免回放模式下意外访问真实网络
+type failingTransport struct {
+	err error
+}
+
+// RoundTrip 直接返回初始化时的错误
+func (t failingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, t.err
+}
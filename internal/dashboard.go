@@ -0,0 +1,112 @@
+// Package internal 包含项目的核心功能实现
+// 该文件提供内置的网页看板：页面通过go:embed打包进程序，不依赖任何CDN资源，
+// 数据来自/api/下的只读接口，另有立即检查、预览消息和测试推送三个操作
+package internal
+
+import (
+	"context"  // 用于测试推送的超时控制
+	_ "embed"  // 用于打包看板页面
+	"net/http" // 用于HTTP处理器
+	"time"     // 用于测试消息中的时间
+)
+
+// dashboardHTML 看板页面，包含全部样式和脚本
+//
+//go:embed web/dashboard.html
+var dashboardHTML []byte
+
+// actionHeader 看板操作请求必须带上的请求头
+// 自定义请求头会触发浏览器的跨域预检，其他网页无法借用户的浏览器发起这些操作
+const actionHeader = "X-Dashboard-Action"
+
+// Dashboard 内置看板
+type Dashboard struct {
+	config  *Config
+	service *AirdropService
+}
+
+// NewDashboard 创建内置看板
+// 参数:
+//   - config: 配置信息，用于测试推送
+//   - service: daemon使用的空投服务，用于请求立即检查和预览消息
+// 返回:
+//   - *Dashboard: 看板实例
+func NewDashboard(config *Config, service *AirdropService) *Dashboard {
+	return &Dashboard{config: config, service: service}
+}
+
+// Register 在路由上注册看板页面和操作接口
+// 参数:
+//   - mux: 本地HTTP服务的路由
+func (d *Dashboard) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/", d.page)
+	mux.HandleFunc("/api/actions/check", action(d.check))
+	mux.HandleFunc("/api/actions/preview", action(d.preview))
+	mux.HandleFunc("/api/actions/test-push", action(d.testPush))
+}
+
+// action 只允许带actionHeader的POST请求
+func action(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			writeJSONError(w, http.StatusMethodNotAllowed, "只支持POST请求")
+			return
+		}
+		if r.Header.Get(actionHeader) == "" {
+			writeJSONError(w, http.StatusForbidden, "缺少"+actionHeader+"请求头")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// page 输出看板页面，其他路径返回404
+func (d *Dashboard) page(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(dashboardHTML)
+}
+
+// check 请求daemon立即执行一次检查，检查结果通过/api/airdrops查看
+func (d *Dashboard) check(w http.ResponseWriter, _ *http.Request) {
+	queued := d.service.RequestCheck()
+	writeJSON(w, http.StatusAccepted, map[string]bool{"queued": queued})
+}
+
+// preview 按daemon最近一次检查的结果生成消息，不访问上游、不写入任何状态
+// 需要最新数据时先执行立即检查
+func (d *Dashboard) preview(w http.ResponseWriter, _ *http.Request) {
+	view := d.service.View()
+	if view.GeneratedAt.IsZero() {
+		writeJSONError(w, http.StatusServiceUnavailable, "尚未完成第一次检查")
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Message     string     `json:"message"`
+		Status      DataStatus `json:"status"`
+		GeneratedAt time.Time  `json:"generatedAt"`
+	}{view.Message(), view.Status, view.GeneratedAt})
+}
+
+// testPush 向所有SendKey发送一条测试消息，结果记录在推送历史中
+func (d *Dashboard) testPush(w http.ResponseWriter, r *http.Request) {
+	if len(d.config.SendKeys) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "未配置SendKey")
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), d.config.CycleDeadline())
+	defer cancel()
+	ctx, _ = NewCycleContext(ctx)
+
+	msg := "这是一条来自看板的测试消息，发送时间 " + time.Now().In(d.config.Location()).Format("2006-01-02 15:04:05")
+	if err := SendToServerChan(ctx, msg, "测试推送", d.config); err != nil {
+		writeJSONError(w, http.StatusGatewayTimeout, "测试推送中止")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int{"recipients": len(d.config.SendKeys)})
+}
@@ -0,0 +1,268 @@
+// Package internal 包含项目的核心功能实现
+// 该文件把变化事件发布为Atom和RSS订阅源，由daemon提供，也可以写成静态文件，
+// 没有Server酱SendKey的人也能用任意阅读器关注空投变化
+package internal
+
+import (
+	"encoding/xml"  // 用于生成Atom和RSS
+	"fmt"           // 用于格式化
+	"net/http"      // 用于订阅地址
+	"os"            // 用于写入静态文件
+	"path/filepath" // 用于按扩展名选择格式
+	"strings"       // 用于字符串处理
+	"time"          // 用于时间格式
+)
+
+// feedEntries 订阅源中最多包含的事件数
+const feedEntries = 50
+
+// feedTitle 订阅源标题
+const feedTitle = "Alpha空投变化"
+
+// feedIDPrefix 订阅源和条目ID的前缀，条目ID由事件ID生成，不随重新生成改变
+const feedIDPrefix = "urn:alpha-wx-notify:"
+
+// FeedConfig 订阅源配置
+type FeedConfig struct {
+	File string `json:"file"` // 有新事件时写入的静态订阅文件，扩展名为.rss时为RSS，否则为Atom；为空表示不写
+	Link string `json:"link"` // 订阅源对外的地址（可选），写入<link>
+}
+
+// kindTitles 变化类型在订阅源中的名称
+var kindTitles = map[string]string{
+	ChangeAdded:       "新增",
+	ChangeRemoved:     "移除",
+	ChangeRescheduled: "改期",
+	ChangeUpdated:     "更新",
+	ChangePoints:      "积分变化",
+}
+
+// EventTitle 返回变化事件的一句话描述
+// 参数:
+//   - e: 变化事件
+// 返回:
+//   - string: 如"改期 ABC(Alpha) 阶段1: 2025-01-01 18:00 → 2025-01-01 20:00"
+func EventTitle(e ChangeEvent) string {
+	kind := kindTitles[e.Kind]
+	if kind == "" {
+		kind = e.Kind
+	}
+	title := fmt.Sprintf("%s %s(%s) 阶段%d", kind, e.Token, e.Name, e.Phase)
+	switch e.Kind {
+	case ChangeRescheduled:
+		title += fmt.Sprintf(": %s %s → %s %s", e.OldDate, e.OldTime, e.Date, e.Time)
+	case ChangePoints:
+		title += fmt.Sprintf(": %s → %s", e.OldPoints, e.Points)
+	case ChangeUpdated:
+		if e.OldAmount != "" {
+			title += fmt.Sprintf(": 数量 %s → %s", e.OldAmount, e.Amount)
+		}
+	}
+	return title
+}
+
+// eventSummary 返回变化事件的详细内容
+func eventSummary(e ChangeEvent) string {
+	lines := []string{
+		"代币: " + e.Token,
+		"项目: " + e.Name,
+		fmt.Sprintf("阶段: %d", e.Phase),
+		strings.TrimSpace("时间: " + e.Date + " " + e.Time),
+	}
+	if e.Amount != "" {
+		lines = append(lines, "数量: "+e.Amount)
+	}
+	if e.Points != "" {
+		lines = append(lines, "积分: "+e.Points)
+	}
+	return strings.Join(lines, "\n")
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	ID       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Updated  string       `xml:"updated"`
+	Category atomCategory `xml:"category"`
+	Content  atomText     `xml:"content"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Category    string  `xml:"category"`
+	Description string  `xml:"description"`
+}
+
+type rssFeed struct {
+	XMLName       xml.Name  `xml:"rss"`
+	Version       string    `xml:"version,attr"`
+	Title         string    `xml:"channel>title"`
+	Link          string    `xml:"channel>link"`
+	Description   string    `xml:"channel>description"`
+	LastBuildDate string    `xml:"channel>lastBuildDate"`
+	Items         []rssItem `xml:"channel>item"`
+}
+
+// feedUpdated 返回订阅源的更新时间：最新事件的时间，没有事件时为now
+func feedUpdated(events []ChangeEvent, now time.Time) time.Time {
+	if len(events) > 0 {
+		return events[0].DetectedAt
+	}
+	return now
+}
+
+// BuildAtomFeed 生成Atom订阅源
+// 参数:
+//   - cfg: 配置信息，提供feed.link
+//   - events: 变化事件，最新的在前
+//   - now: 没有事件时使用的更新时间
+// 返回:
+//   - []byte: Atom XML
+//   - error: 编码失败时返回错误
+func BuildAtomFeed(cfg *Config, events []ChangeEvent, now time.Time) ([]byte, error) {
+	feed := atomFeed{
+		ID:      feedIDPrefix + "feed",
+		Title:   feedTitle,
+		Updated: feedUpdated(events, now).UTC().Format(time.RFC3339),
+		Author:  "alpha_wx_notify",
+	}
+	if cfg.Feed.Link != "" {
+		feed.Links = append(feed.Links, atomLink{Href: cfg.Feed.Link, Rel: "self"})
+	}
+	for _, e := range events {
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:       feedIDPrefix + "event:" + e.ID,
+			Title:    EventTitle(e),
+			Updated:  e.DetectedAt.UTC().Format(time.RFC3339),
+			Category: atomCategory{Term: e.Kind},
+			Content:  atomText{Type: "text", Body: eventSummary(e)},
+		})
+	}
+	return marshalFeed(feed)
+}
+
+// BuildRSSFeed 生成RSS 2.0订阅源
+// 参数:
+//   - cfg: 配置信息，提供feed.link
+//   - events: 变化事件，最新的在前
+//   - now: 没有事件时使用的更新时间
+// 返回:
+//   - []byte: RSS XML
+//   - error: 编码失败时返回错误
+func BuildRSSFeed(cfg *Config, events []ChangeEvent, now time.Time) ([]byte, error) {
+	feed := rssFeed{
+		Version:       "2.0",
+		Title:         feedTitle,
+		Link:          cfg.Feed.Link,
+		Description:   "Binance Alpha空投的新增、改期、积分变化和移除",
+		LastBuildDate: feedUpdated(events, now).Format(time.RFC1123Z),
+	}
+	for _, e := range events {
+		feed.Items = append(feed.Items, rssItem{
+			Title:       EventTitle(e),
+			GUID:        rssGUID{IsPermaLink: "false", Value: feedIDPrefix + "event:" + e.ID},
+			PubDate:     e.DetectedAt.Format(time.RFC1123Z),
+			Category:    e.Kind,
+			Description: eventSummary(e),
+		})
+	}
+	return marshalFeed(feed)
+}
+
+// marshalFeed 编码XML并加上声明
+func marshalFeed(v interface{}) ([]byte, error) {
+	body, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(body, '\n')...), nil
+}
+
+// recentEvents 读取最近的feedEntries条事件，最新的在前
+func recentEvents(cfg *Config) ([]ChangeEvent, error) {
+	events, err := LoadChangeEvents(cfg, feedEntries)
+	if err != nil {
+		return nil, err
+	}
+	return newestFirst(events), nil
+}
+
+// WriteFeedFile 把最近的变化事件写成静态订阅文件
+// 参数:
+//   - cfg: 配置信息
+//   - file: 输出文件，扩展名为.rss时输出RSS，否则输出Atom
+//   - now: 没有事件时使用的更新时间
+// 返回:
+//   - error: 读取事件或写入文件失败时返回错误
+func WriteFeedFile(cfg *Config, file string, now time.Time) error {
+	events, err := recentEvents(cfg)
+	if err != nil {
+		return err
+	}
+	build := BuildAtomFeed
+	if strings.EqualFold(filepath.Ext(file), ".rss") {
+		build = BuildRSSFeed
+	}
+	body, err := build(cfg, events, now)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, body, 0644)
+}
+
+// FeedHandler 返回订阅源处理器
+// 参数:
+//   - config: 配置信息
+//   - rss: true输出RSS，false输出Atom
+// 返回:
+//   - http.HandlerFunc: /feed.atom或/feed.rss处理器
+func FeedHandler(config *Config, rss bool) http.HandlerFunc {
+	build, contentType := BuildAtomFeed, "application/atom+xml; charset=utf-8"
+	if rss {
+		build, contentType = BuildRSSFeed, "application/rss+xml; charset=utf-8"
+	}
+	return readOnly(func(w http.ResponseWriter, _ *http.Request) {
+		events, err := recentEvents(config)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "读取变化事件失败")
+			return
+		}
+		body, err := build(config, events, time.Now())
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "生成订阅源失败")
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
+	})
+}
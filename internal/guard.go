@@ -0,0 +1,294 @@
+// Package internal 包含项目的核心功能实现
+// 该文件实现上游响应的合理性检查，可疑的响应会被隔离而不参与快照比较
+package internal
+
+import (
+	"context"       // 用于日志中的cycle_id
+	"encoding/json" // 用于隔离文件编码
+	"fmt"           // 用于格式化原因描述
+	"os"            // 用于文件操作
+	"path/filepath" // 用于拼接隔离目录路径
+	"slices"        // 用于签名中的类别去重
+	"sort"          // 用于生成与顺序无关的签名
+	"strings"       // 用于拼接签名
+	"time"          // 用于时间处理
+)
+
+// GuardConfig 响应合理性检查配置
+type GuardConfig struct {
+	Disabled         bool `json:"disabled"`         // 是否关闭检查
+	MaxVanishPercent int  `json:"maxVanishPercent"` // 上次响应中未过期的项目消失超过该比例时视为可疑，默认50
+	MinBaseline      int  `json:"minBaseline"`      // 上次响应中未过期项目少于该数量时不做消失比例检查，默认3
+}
+
+// 合理性检查的默认值
+const (
+	defaultMaxVanishPercent = 50
+	defaultMinBaseline      = 3
+)
+
+// quarantineDir 可疑响应的隔离目录，位于状态目录下
+const quarantineDir = "quarantine"
+
+// quarantineAlertFile 最近一次已告警的隔离原因，位于状态目录下，响应被接受时删除
+const quarantineAlertFile = "quarantine_alert.json"
+
+// 可疑原因的类别，隔离告警按类别去重，不受原因描述中数量变化的影响
+const (
+	SanityMissingFields = "missing_fields" // 超过一半的项目缺少token或date
+	SanityEmptied       = "emptied"        // 项目数骤降为0
+	SanityVanished      = "vanished"       // 上次未过期的项目大量消失
+	SanityAllPast       = "all_past"       // 所有项目的日期都已过去
+)
+
+// SanityIssue 合理性检查发现的一个可疑之处
+type SanityIssue struct {
+	Kind   string // 类别，SanityMissingFields等
+	Reason string // 给人看的描述，包含具体数量
+}
+
+// issueReasons 返回可疑之处的描述，用于日志、状态和隔离文件
+func issueReasons(issues []SanityIssue) []string {
+	reasons := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		reasons = append(reasons, issue.Reason)
+	}
+	return reasons
+}
+
+// QuarantineRecord 隔离文件的内容
+type QuarantineRecord struct {
+	ReceivedAt time.Time       `json:"receivedAt"` // 收到响应的时间
+	Reasons    []string        `json:"reasons"`    // 判定为可疑的原因
+	Body       json.RawMessage `json:"body"`       // 上游原始响应体
+}
+
+// checkResponseSanity 将本次响应与上次被接受的响应比较，找出可疑之处
+// 上次被接受的响应即响应缓存，只有通过检查的响应才会写入缓存
+// 参数:
+//   - ctx: 上下文，用于日志中的cycle_id
+//   - resp: 本次解析出的响应
+// 返回:
+//   - []SanityIssue: 可疑之处，为空表示响应正常
+func (s *AirdropService) checkResponseSanity(ctx context.Context, resp *ApiResponse) []SanityIssue {
+	var guard GuardConfig
+	if s.config != nil {
+		guard = s.config.Guard
+	}
+	if guard.Disabled {
+		return nil
+	}
+	maxVanish := guard.MaxVanishPercent
+	if maxVanish <= 0 {
+		maxVanish = defaultMaxVanishPercent
+	}
+	minBaseline := guard.MinBaseline
+	if minBaseline <= 0 {
+		minBaseline = defaultMinBaseline
+	}
+
+	today := s.now().Format("2006-01-02")
+	var issues []SanityIssue
+
+	// 必填字段缺失的项目超过一半，多半是上游返回了异常结构
+	missing := 0
+	for _, item := range resp.Airdrops {
+		if item.Token == "" || item.Date == "" {
+			missing++
+		}
+	}
+	if len(resp.Airdrops) > 0 && missing*2 > len(resp.Airdrops) {
+		issues = append(issues, SanityIssue{SanityMissingFields, fmt.Sprintf("%d/%d 个项目缺少token或date", missing, len(resp.Airdrops))})
+	}
+
+	// 以上次被接受的响应为基准
+	baseline := s.loadBaseline(ctx)
+	if baseline == nil {
+		return issues // 没有历史可比，只做字段检查
+	}
+
+	// 上次响应中今天及以后的项目，正常情况下本次仍应存在
+	current := make(map[string]bool)
+	hasUpcoming := false
+	for _, item := range resp.Airdrops {
+		current[airdropKey(item)] = true
+		if item.Date >= today {
+			hasUpcoming = true
+		}
+	}
+	upcoming, vanished := 0, 0
+	for _, item := range baseline.Airdrops {
+		if item.Date < today {
+			continue
+		}
+		upcoming++
+		if !current[airdropKey(item)] {
+			vanished++
+		}
+	}
+
+	if len(resp.Airdrops) == 0 && len(baseline.Airdrops) > 0 {
+		issues = append(issues, SanityIssue{SanityEmptied, fmt.Sprintf("项目数从 %d 骤降为0", len(baseline.Airdrops))})
+	} else if upcoming >= minBaseline && vanished*100 > upcoming*maxVanish {
+		issues = append(issues, SanityIssue{SanityVanished, fmt.Sprintf("上次未过期的 %d 个项目中有 %d 个消失", upcoming, vanished)})
+	}
+
+	if len(resp.Airdrops) > 0 && !hasUpcoming && upcoming > 0 {
+		issues = append(issues, SanityIssue{SanityAllPast, "所有项目的日期都已过去"})
+	}
+	return issues
+}
+
+// loadBaseline 读取上次被接受的响应作为检查基准
+// 直接读取响应缓存，不受maxStaleness限制：缓存回退被禁用或缓存较旧时仍应检查项目是否消失
+// 回放时没有基准，只做字段检查，避免结果取决于本机的缓存
+// 参数:
+//   - ctx: 上下文，用于日志中的cycle_id
+// 返回:
+//   - *ApiResponse: 上次被接受的响应，没有缓存或无法解析时返回nil
+func (s *AirdropService) loadBaseline(ctx context.Context) *ApiResponse {
+	if s.config == nil || s.replaying() {
+		return nil
+	}
+	cached, err := LoadResponseCache(s.config.StatePath(responseCacheFile))
+	if err != nil {
+		Logger(ctx).Error("读取检查基准失败", LogKeyError, err)
+		return nil
+	}
+	if cached == nil {
+		return nil
+	}
+	baseline, _, err := decodeApiResponse(cached.Body)
+	if err != nil {
+		Logger(ctx).Error("解析检查基准失败", LogKeyError, err)
+		return nil
+	}
+	return baseline
+}
+
+// airdropKey 生成用于跨响应匹配同一空投的键
+func airdropKey(item Airdrop) string {
+	return fmt.Sprintf("%s|%d", item.Token, item.Phase)
+}
+
+// quarantineResponse 把可疑响应保存到隔离目录，便于事后排查
+// 参数:
+//   - body: 上游原始响应体
+//   - reasons: 判定为可疑的原因
+// 返回:
+//   - string: 隔离文件路径
+//   - error: 写入失败时返回错误
+func (s *AirdropService) quarantineResponse(body []byte, reasons []string) (string, error) {
+	dir := s.config.StatePath(quarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	record := QuarantineRecord{ReceivedAt: now, Reasons: reasons, Body: body}
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "response-"+now.Format("20060102-150405")+".json")
+	return path, os.WriteFile(path, data, 0644)
+}
+
+// quarantineAlert 保存在状态目录中的最近一次已告警的隔离
+type quarantineAlert struct {
+	Signature string    `json:"signature"` // 隔离原因的签名
+	AlertedAt time.Time `json:"alertedAt"` // 告警发送时间
+}
+
+// quarantineSignature 生成隔离原因的签名
+// 只使用原因的类别，与顺序和描述中的数量无关，上游持续异常但数量每次略有不同时不会重复告警
+func quarantineSignature(issues []SanityIssue) string {
+	kinds := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		if !slices.Contains(kinds, issue.Kind) {
+			kinds = append(kinds, issue.Kind)
+		}
+	}
+	sort.Strings(kinds)
+	return strings.Join(kinds, ",")
+}
+
+// QuarantineAlertDue 判断本周期的隔离是否需要告警
+// 隔离原因与上次已告警的相同时不再告警，避免上游持续异常时每个周期都打扰运维人员
+// 返回:
+//   - bool: 本周期有响应被隔离且原因与上次告警的不同
+func (s *AirdropService) QuarantineAlertDue() bool {
+	if len(s.quarantined) == 0 || s.replaying() {
+		return false
+	}
+	var last quarantineAlert
+	if data, err := os.ReadFile(s.config.StatePath(quarantineAlertFile)); err == nil {
+		json.Unmarshal(data, &last)
+	}
+	return quarantineSignature(s.quarantined) != last.Signature
+}
+
+// RecordQuarantineAlert 保存本周期已告警的隔离原因，应在告警发送成功后调用
+// 参数:
+//   - ctx: 上下文，用于日志中的cycle_id
+func (s *AirdropService) RecordQuarantineAlert(ctx context.Context) {
+	if len(s.quarantined) == 0 || s.replaying() {
+		return
+	}
+	path := s.config.StatePath(quarantineAlertFile)
+	data, err := json.MarshalIndent(quarantineAlert{Signature: quarantineSignature(s.quarantined), AlertedAt: time.Now()}, "", "  ")
+	if err == nil {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		Logger(ctx).Error("保存隔离告警记录失败", LogKeyPath, path, LogKeyError, err)
+	}
+}
+
+// clearQuarantineAlert 响应被接受后删除隔离告警记录，之后再次隔离时重新告警
+func (s *AirdropService) clearQuarantineAlert(ctx context.Context) {
+	path := s.config.StatePath(quarantineAlertFile)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		Logger(ctx).Error("删除隔离告警记录失败", LogKeyPath, path, LogKeyError, err)
+	}
+}
+
+// AcceptQuarantined 把隔离的响应作为新的检查基准写入响应缓存
+// 上游确实发生了大幅变化（如批量下架）时使用，之后的响应与它比较，不再被隔离
+// 参数:
+//   - cfg: 配置信息，用于定位状态目录
+//   - file: 隔离文件路径，为空时使用最近一次隔离的文件
+// 返回:
+//   - string: 被接受的隔离文件路径
+//   - error: 没有隔离文件、文件无法解析或写入缓存失败时返回错误
+func AcceptQuarantined(cfg *Config, file string) (string, error) {
+	if file == "" {
+		files, err := filepath.Glob(filepath.Join(cfg.StatePath(quarantineDir), "response-*.json"))
+		if err != nil {
+			return "", err
+		}
+		if len(files) == 0 {
+			return "", fmt.Errorf("%s下没有隔离的响应", cfg.StatePath(quarantineDir))
+		}
+		sort.Strings(files) // 文件名带时间，最后一个为最近的
+		file = files[len(files)-1]
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	var record QuarantineRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return "", fmt.Errorf("解析隔离文件失败: %v", err)
+	}
+	if _, _, err := decodeApiResponse(record.Body); err != nil {
+		return "", fmt.Errorf("隔离的响应无法解析: %v", err)
+	}
+	if err := SaveResponseCache(cfg.StatePath(responseCacheFile), record.Body, record.ReceivedAt); err != nil {
+		return "", err
+	}
+	if err := os.Remove(cfg.StatePath(quarantineAlertFile)); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	return file, nil
+}
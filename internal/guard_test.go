@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// guardToday 合理性检查测试中的"今天"
+var guardToday = time.Date(2025, 9, 10, 12, 0, 0, 0, time.UTC)
+
+// drops 按代币生成空投，日期为offset天后
+func drops(offset int, tokens ...string) []Airdrop {
+	out := make([]Airdrop, 0, len(tokens))
+	for _, token := range tokens {
+		out = append(out, Airdrop{Token: token, Name: token, Date: guardToday.AddDate(0, 0, offset).Format("2006-01-02"), Phase: 1})
+	}
+	return out
+}
+
+// guardService 创建以baseline为上次被接受响应的服务，baseline为nil时没有缓存
+func guardService(t *testing.T, cfg *Config, baseline []Airdrop, cachedAt time.Time) *AirdropService {
+	t.Helper()
+	cfg.StateDir = t.TempDir()
+	if baseline != nil {
+		body, _ := json.Marshal(ApiResponse{Airdrops: baseline})
+		if err := SaveResponseCache(cfg.StatePath(responseCacheFile), body, cachedAt); err != nil {
+			t.Fatalf("写入缓存失败: %v", err)
+		}
+	}
+	s := NewAirdropService(cfg)
+	s.replayClock = guardToday
+	return s
+}
+
+func TestCheckResponseSanity(t *testing.T) {
+	baseline := drops(1, "A", "B", "C", "D")
+	cases := []struct {
+		name     string
+		cfg      Config
+		baseline []Airdrop
+		cachedAt time.Time
+		resp     []Airdrop
+		want     string // 可疑之处的类别，即quarantineSignature
+	}{
+		{"与上次相同", Config{}, baseline, guardToday, baseline, ""},
+		{"没有历史时只检查字段", Config{}, nil, guardToday, drops(1, "A"), ""},
+		{"超过一半缺少token", Config{}, nil, guardToday, append(drops(1, "", ""), drops(1, "A")...), SanityMissingFields},
+		{"骤降为0", Config{}, baseline, guardToday, []Airdrop{}, SanityEmptied},
+		{"消失一半不算可疑", Config{}, baseline, guardToday, drops(1, "A", "B"), ""},
+		{"消失超过一半", Config{}, baseline, guardToday, drops(1, "A", "X", "Y"), SanityVanished},
+		{"自定义消失比例", Config{Guard: GuardConfig{MaxVanishPercent: 20}}, baseline, guardToday, drops(1, "A", "B", "C"), SanityVanished},
+		{"基准太少不检查消失", Config{}, drops(1, "A", "B"), guardToday, drops(1, "X"), ""},
+		{"所有日期都已过去", Config{}, baseline, guardToday, drops(-1, "A", "B", "C", "D"), SanityAllPast},
+		{"关闭检查", Config{Guard: GuardConfig{Disabled: true}}, baseline, guardToday, []Airdrop{}, ""},
+		// 缓存超过maxStaleness或禁用了缓存回退时，仍以它为基准
+		{"基准超过maxStaleness", Config{}, baseline, guardToday.Add(-48 * time.Hour), []Airdrop{}, SanityEmptied},
+		{"禁用缓存回退", Config{MaxStaleness: -1}, baseline, guardToday, drops(1, "X", "Y", "Z"), SanityVanished},
+		// 回放时不以本机的缓存为基准，只检查字段
+		{"回放时没有基准", Config{Capture: CaptureConfig{Mode: CaptureReplay}}, baseline, guardToday, []Airdrop{}, ""},
+	}
+	for _, c := range cases {
+		cfg := c.cfg
+		s := guardService(t, &cfg, c.baseline, c.cachedAt)
+		issues := s.checkResponseSanity(context.Background(), &ApiResponse{Airdrops: c.resp})
+		if got := quarantineSignature(issues); got != c.want {
+			t.Errorf("%s: 期望%q，实际%v", c.name, c.want, issues)
+		}
+	}
+}
+
+func TestReplayIgnoresLiveCache(t *testing.T) {
+	cfg := &Config{Capture: CaptureConfig{Mode: CaptureReplay}}
+	s := guardService(t, cfg, drops(1, "A"), guardToday)
+	if resp, _ := s.loadStaleAirdropData(context.Background()); resp != nil {
+		t.Error("回放时不应回退到本机的响应缓存")
+	}
+
+	// 非回放时缓存按s.now()判断是否过期，而不是真实时间
+	cfg = &Config{}
+	s = guardService(t, cfg, drops(1, "A"), guardToday.Add(-time.Hour))
+	if resp, _ := s.loadStaleAirdropData(context.Background()); resp == nil {
+		t.Error("一小时前的缓存应可用于回退")
+	}
+}
+
+func TestQuarantineAlertDedup(t *testing.T) {
+	s := guardService(t, &Config{}, nil, time.Time{})
+	ctx := context.Background()
+	vanished := func(n int) SanityIssue {
+		return SanityIssue{SanityVanished, fmt.Sprintf("上次未过期的 10 个项目中有 %d 个消失", n)}
+	}
+	emptied := SanityIssue{SanityEmptied, "项目数从 10 骤降为0"}
+
+	steps := []struct {
+		name   string
+		issues []SanityIssue
+		record bool // 告警后记录
+		clear  bool // 检查前有响应被接受
+		want   bool
+	}{
+		{"第一次隔离应告警", []SanityIssue{vanished(6), emptied}, true, false, true},
+		{"类别相同、顺序不同时不重复告警", []SanityIssue{emptied, vanished(6)}, false, false, false},
+		{"描述中的数量变化不重复告警", []SanityIssue{vanished(7), emptied}, false, false, false},
+		{"类别变化时应告警", []SanityIssue{vanished(7)}, true, false, true},
+		{"同一类别出现多次按一次计", []SanityIssue{vanished(7), vanished(8)}, false, false, false},
+		{"响应被接受后再次隔离应重新告警", []SanityIssue{vanished(7)}, false, true, true},
+	}
+	for _, step := range steps {
+		if step.clear {
+			s.clearQuarantineAlert(ctx)
+		}
+		s.quarantined = step.issues
+		if got := s.QuarantineAlertDue(); got != step.want {
+			t.Fatalf("%s: 期望%v，实际%v", step.name, step.want, got)
+		}
+		if step.record {
+			s.RecordQuarantineAlert(ctx)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+// Package internal 包含项目的核心功能实现
+// 该文件记录daemon的运行状况，并提供/healthz（存活）和/readyz（就绪）接口，
+// 供进程管理工具在实例卡死或数据长期未更新时重启
+package internal
+
+import (
+	"encoding/json" // 用于输出JSON
+	"net/http"      // 用于HTTP处理器
+	"os"            // 用于读取快照文件时间
+	"sync"          // 用于保护运行状态
+	"time"          // 用于时间计算
+)
+
+// defaultReadyMaxAge 未配置readyMaxAge时数据允许的最长未更新时间
+const defaultReadyMaxAge = 30 * time.Minute
+
+// HealthConfig 健康检查配置
+type HealthConfig struct {
+	ReadyMaxAge int `json:"readyMaxAge"` // 最近一次成功获取数据超过多少分钟后/readyz返回503，默认30
+}
+
+// healthTracker 进程内的运行状态
+type healthTracker struct {
+	mu                  sync.Mutex
+	startedAt           time.Time // 进程启动时间
+	lastCycleAt         time.Time // 最近一次检查周期结束的时间
+	lastFetchAt         time.Time // 最近一次成功从上游获取数据的时间
+	lastPushAt          time.Time // 最近一次成功推送的时间
+	consecutiveFailures int       // 连续未能从上游获取新数据的周期数
+}
+
+// health 全局运行状态，由检查周期写入、HTTP接口读取
+var health = &healthTracker{startedAt: time.Now()}
+
+// recordFetch 记录一次数据获取的结果，成功时清零连续失败次数
+func (h *healthTracker) recordFetch(ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if ok {
+		h.lastFetchAt = time.Now()
+		h.consecutiveFailures = 0
+	} else {
+		h.consecutiveFailures++
+	}
+}
+
+// recordPush 记录一次成功的推送
+func (h *healthTracker) recordPush() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastPushAt = time.Now()
+}
+
+// recordCycle 记录检查周期结束
+func (h *healthTracker) recordCycle() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastCycleAt = time.Now()
+}
+
+// HealthReport /healthz和/readyz返回的内容
+type HealthReport struct {
+	Status              string     `json:"status"`                       // ok或fail
+	Reason              string     `json:"reason,omitempty"`             // 失败原因
+	StartedAt           time.Time  `json:"startedAt"`                    // 进程启动时间
+	LastCycleAt         *time.Time `json:"lastCycleAt,omitempty"`        // 最近一次检查周期结束的时间
+	LastFetchAt         *time.Time `json:"lastFetchAt,omitempty"`        // 最近一次成功获取数据的时间
+	LastPushAt          *time.Time `json:"lastPushAt,omitempty"`         // 最近一次成功推送的时间
+	ConsecutiveFailures int        `json:"consecutiveFailures"`          // 连续获取失败的周期数
+	BreakerState        string     `json:"breakerState"`                 // 价格接口熔断器状态
+	SnapshotAgeSeconds  *int64     `json:"snapshotAgeSeconds,omitempty"` // 快照文件距上次写入的秒数
+	DataAgeSeconds      *int64     `json:"dataAgeSeconds,omitempty"`     // 距最近一次成功获取数据的秒数
+}
+
+// optionalTime 零值时间返回nil，便于JSON中省略
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// HealthChecker 根据运行状态生成健康报告
+type HealthChecker struct {
+	config  *Config
+	service *AirdropService
+}
+
+// NewHealthChecker 创建健康检查器
+// 参数:
+//   - config: 配置信息，用于检查间隔、周期超时和就绪阈值
+//   - service: daemon使用的空投服务，用于读取熔断器状态
+// 返回:
+//   - *HealthChecker: 健康检查器实例
+func NewHealthChecker(config *Config, service *AirdropService) *HealthChecker {
+	return &HealthChecker{config: config, service: service}
+}
+
+// readyMaxAge 返回数据允许的最长未更新时间
+func (c *HealthChecker) readyMaxAge() time.Duration {
+	if c.config == nil || c.config.Health.ReadyMaxAge <= 0 {
+		return defaultReadyMaxAge
+	}
+	return time.Duration(c.config.Health.ReadyMaxAge) * time.Minute
+}
+
+// liveMaxAge 返回两次检查周期结束之间允许的最长间隔，超过说明循环卡住了
+// 为检查间隔加上两倍的周期超时
+func (c *HealthChecker) liveMaxAge() time.Duration {
+	return c.config.CheckInterval() + 2*c.config.CycleDeadline()
+}
+
+// report 生成当前状态的报告，不含判定结果
+func (c *HealthChecker) report(now time.Time) HealthReport {
+	health.mu.Lock()
+	r := HealthReport{
+		Status:              "ok",
+		StartedAt:           health.startedAt,
+		LastCycleAt:         optionalTime(health.lastCycleAt),
+		LastFetchAt:         optionalTime(health.lastFetchAt),
+		LastPushAt:          optionalTime(health.lastPushAt),
+		ConsecutiveFailures: health.consecutiveFailures,
+	}
+	health.mu.Unlock()
+
+	if c.service != nil {
+		r.BreakerState = c.service.PriceBreakerState()
+	}
+	if r.LastFetchAt != nil {
+		age := int64(now.Sub(*r.LastFetchAt).Seconds())
+		r.DataAgeSeconds = &age
+	}
+	if c.config != nil {
+		if info, err := os.Stat(c.config.StatePath(SnapshotFile)); err == nil {
+			age := int64(now.Sub(info.ModTime()).Seconds())
+			r.SnapshotAgeSeconds = &age
+		}
+	}
+	return r
+}
+
+// Live 判断进程是否存活：检查循环在规定时间内完成过一个周期
+// 返回:
+//   - HealthReport: 健康报告，Status为fail时Reason说明原因
+func (c *HealthChecker) Live() HealthReport {
+	now := time.Now()
+	r := c.report(now)
+	last := r.StartedAt
+	if r.LastCycleAt != nil {
+		last = *r.LastCycleAt
+	}
+	if now.Sub(last) > c.liveMaxAge() {
+		r.Status = "fail"
+		r.Reason = "检查循环超过" + c.liveMaxAge().String() + "没有完成"
+	}
+	return r
+}
+
+// Ready 判断实例是否就绪：最近一次成功获取数据不超过readyMaxAge
+// 返回:
+//   - HealthReport: 健康报告，Status为fail时Reason说明原因
+func (c *HealthChecker) Ready() HealthReport {
+	r := c.Live()
+	if r.Status != "ok" {
+		return r
+	}
+	switch {
+	case r.LastFetchAt == nil:
+		r.Status = "fail"
+		r.Reason = "尚未成功获取过数据"
+	case time.Since(*r.LastFetchAt) > c.readyMaxAge():
+		r.Status = "fail"
+		r.Reason = "数据超过" + c.readyMaxAge().String() + "没有更新"
+	}
+	return r
+}
+
+// writeHealth 输出报告，失败时状态码为503
+func writeHealth(w http.ResponseWriter, r HealthReport) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if r.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(r)
+}
+
+// LiveHandler /healthz处理器
+func (c *HealthChecker) LiveHandler(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, c.Live())
+}
+
+// ReadyHandler /readyz处理器
+func (c *HealthChecker) ReadyHandler(w http.ResponseWriter, _ *http.Request) {
+	writeHealth(w, c.Ready())
+}
@@ -0,0 +1,272 @@
+// Package internal 包含项目的核心功能实现
+// 该文件记录空投变化事件和推送历史，保存在状态目录下的JSONL文件中，
+// 供本地API、看板等读取，只保留最近的若干条
+package internal
+
+import (
+	"bufio"         // 用于逐行读取
+	"context"       // 用于日志中的cycle_id
+	"crypto/sha1"   // 用于生成事件ID
+	"encoding/hex"  // 用于编码事件ID
+	"encoding/json" // 用于记录的编解码
+	"fmt"           // 用于格式化
+	"os"            // 用于文件操作
+	"strings"       // 用于字符串处理
+	"sync"          // 用于串行化文件写入
+	"time"          // 用于时间处理
+)
+
+// 历史文件名，位于状态目录下
+const (
+	eventsFile     = "events.jsonl"     // 空投变化事件
+	deliveriesFile = "deliveries.jsonl" // 推送历史
+)
+
+// maxHistoryRecords 每个历史文件最多保留的记录数
+const maxHistoryRecords = 500
+
+// ChangeEvent 一次空投变化
+// 以代币和阶段识别同一个空投，Old开头的字段为变化前的值
+type ChangeEvent struct {
+	ID         string    `json:"id"`                  // 事件ID，由变化内容和检测时间生成，保存后不再改变
+	DetectedAt time.Time `json:"detectedAt"`          // 检测到变化的时间
+	Kind       string    `json:"kind"`                // ChangeAdded、ChangeRemoved、ChangeRescheduled、ChangeUpdated或ChangePoints
+	Token      string    `json:"token"`               // 代币符号
+	Name       string    `json:"name"`                // 项目名称
+	Phase      int       `json:"phase"`               // 空投阶段
+	Date       string    `json:"date,omitempty"`      // 空投日期，removed时为变化前的日期
+	Time       string    `json:"time,omitempty"`      // 空投时间
+	Amount     string    `json:"amount,omitempty"`    // 空投数量
+	OldDate    string    `json:"oldDate,omitempty"`   // 变化前的日期，只在rescheduled时填写
+	OldTime    string    `json:"oldTime,omitempty"`   // 变化前的时间，只在rescheduled时填写
+	OldAmount  string    `json:"oldAmount,omitempty"` // 变化前的数量，只在数量变化时填写
+	Points     string    `json:"points,omitempty"`    // 所需积分，只在points时填写
+	OldPoints  string    `json:"oldPoints,omitempty"` // 变化前的积分，只在points时填写
+}
+
+// Delivery 一次推送记录
+type Delivery struct {
+	SentAt    time.Time `json:"sentAt"`          // 发送时间
+	Channel   string    `json:"channel"`         // ChannelServerChan或ChannelAlert
+	Recipient string    `json:"recipient"`       // 接收人的脱敏标识
+	Title     string    `json:"title"`           // 消息标题
+	Result    string    `json:"result"`          // sent或failed
+	Error     string    `json:"error,omitempty"` // 失败原因，已脱敏
+}
+
+// historyMu 串行化历史文件的读写，检查周期和推送可能同时写入
+var historyMu sync.Mutex
+
+// appendHistory 向JSONL文件追加记录，超过maxHistoryRecords时丢弃最早的记录
+func appendHistory[T any](path string, records ...T) error {
+	if len(records) == 0 {
+		return nil
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	existing, err := readHistory[T](path, 0)
+	if err != nil {
+		return err
+	}
+	all := append(existing, records...)
+	if len(all) > maxHistoryRecords {
+		all = all[len(all)-maxHistoryRecords:]
+	}
+
+	var b strings.Builder
+	for _, r := range all {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+// readHistory 读取JSONL文件中的记录，按写入顺序返回
+// limit大于0时只返回最近的limit条；文件不存在时返回空；无法解析的行被跳过
+func readHistory[T any](path string, limit int) ([]T, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []T
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var r T
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[len(records)-limit:]
+	}
+	return records, nil
+}
+
+// eventID 根据事件内容和检测时间生成ID
+func eventID(e ChangeEvent) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%d|%s|%s|%s|%s|%d",
+		e.Kind, e.Token, e.Phase, e.Date, e.Time, e.Amount, e.Points, e.DetectedAt.Unix())))
+	return hex.EncodeToString(sum[:6])
+}
+
+// DiffSnapshots 列出两个快照之间的变化
+// 以代币和阶段识别同一个空投，同一空投日期时间和其他字段都变化时只记为rescheduled
+// 参数:
+//   - oldSnapshot: 旧的快照字符串
+//   - newSnapshot: 新的快照字符串
+// 返回:
+//   - []ChangeEvent: 变化事件，按新快照的顺序排列，消失的空投在最后
+func (s *AirdropService) DiffSnapshots(oldSnapshot, newSnapshot string) []ChangeEvent {
+	key := func(item SnapshotItem) string {
+		return fmt.Sprintf("%s|%d", item.Token, item.Phase)
+	}
+	oldItems := s.parseSnapshot(oldSnapshot)
+	oldByKey := make(map[string]SnapshotItem)
+	for _, item := range oldItems {
+		oldByKey[key(item)] = item
+	}
+
+	detectedAt := s.now()
+	newEvent := func(kind string, item SnapshotItem) ChangeEvent {
+		return ChangeEvent{
+			DetectedAt: detectedAt,
+			Kind:       kind,
+			Token:      item.Token,
+			Name:       item.Name,
+			Phase:      item.Phase,
+			Date:       item.Date,
+			Time:       item.Time,
+			Amount:     item.Amount,
+		}
+	}
+
+	var events []ChangeEvent
+	seen := make(map[string]bool)
+	for _, item := range s.parseSnapshot(newSnapshot) {
+		k := key(item)
+		seen[k] = true
+		old, ok := oldByKey[k]
+		var e ChangeEvent
+		switch {
+		case !ok:
+			e = newEvent(ChangeAdded, item)
+		case old.Date != item.Date || old.Time != item.Time:
+			e = newEvent(ChangeRescheduled, item)
+			e.OldDate, e.OldTime = old.Date, old.Time
+		case old != item:
+			e = newEvent(ChangeUpdated, item)
+		default:
+			continue
+		}
+		if ok && old.Amount != item.Amount {
+			e.OldAmount = old.Amount
+		}
+		events = append(events, e)
+	}
+	for _, item := range oldItems {
+		if !seen[key(item)] {
+			events = append(events, newEvent(ChangeRemoved, item))
+		}
+	}
+
+	for i := range events {
+		events[i].ID = eventID(events[i])
+	}
+	return events
+}
+
+// RecordSnapshotChanges 统计两个快照之间的变化并追加到事件历史
+// 回放模式下只更新指标，不写入历史文件
+// 参数:
+//   - ctx: 上下文，用于日志
+//   - oldSnapshot: 旧的快照字符串
+//   - newSnapshot: 新的快照字符串
+func (s *AirdropService) RecordSnapshotChanges(ctx context.Context, oldSnapshot, newSnapshot string) {
+	events := s.DiffSnapshots(oldSnapshot, newSnapshot)
+	counts := make(map[string]int)
+	for _, e := range events {
+		counts[e.Kind]++
+	}
+	RecordChanges(counts)
+	s.saveChangeEvents(ctx, events)
+}
+
+// saveChangeEvents 追加变化事件，配置了feed.file时同时更新静态订阅文件
+// 回放模式下不写入
+func (s *AirdropService) saveChangeEvents(ctx context.Context, events []ChangeEvent) {
+	if s.replaying() || len(events) == 0 {
+		return
+	}
+	logger := Logger(ctx)
+	path := s.config.StatePath(eventsFile)
+	if err := appendHistory(path, events...); err != nil {
+		logger.Error("保存变化事件失败", LogKeyPath, path, LogKeyError, err)
+		return
+	}
+	if s.config.Feed.File != "" {
+		if err := WriteFeedFile(s.config, s.config.Feed.File, s.now()); err != nil {
+			logger.Error("更新订阅文件失败", LogKeyPath, s.config.Feed.File, LogKeyError, err)
+		}
+	}
+}
+
+// LoadChangeEvents 读取最近的变化事件
+// 参数:
+//   - cfg: 配置信息，用于定位状态目录
+//   - limit: 最多返回的条数，0表示全部
+// 返回:
+//   - []ChangeEvent: 变化事件，按检测时间从早到晚排列
+//   - error: 读取失败时返回错误
+func LoadChangeEvents(cfg *Config, limit int) ([]ChangeEvent, error) {
+	return readHistory[ChangeEvent](cfg.StatePath(eventsFile), limit)
+}
+
+// LoadDeliveries 读取最近的推送记录
+// 参数:
+//   - cfg: 配置信息，用于定位状态目录
+//   - limit: 最多返回的条数，0表示全部
+// 返回:
+//   - []Delivery: 推送记录，按发送时间从早到晚排列
+//   - error: 读取失败时返回错误
+func LoadDeliveries(cfg *Config, limit int) ([]Delivery, error) {
+	return readHistory[Delivery](cfg.StatePath(deliveriesFile), limit)
+}
+
+// recordDelivery 记录一次推送的指标和历史
+// 历史写入失败只打印日志，不影响推送
+func recordDelivery(ctx context.Context, cfg *Config, channel, sendkey, title string, err error) {
+	recordNotification(channel, sendkey, err)
+	if cfg == nil || cfg.Capture.Mode == CaptureReplay {
+		return
+	}
+	d := Delivery{
+		SentAt:    time.Now(),
+		Channel:   channel,
+		Recipient: recipientLabel(sendkey),
+		Title:     title,
+		Result:    "sent",
+	}
+	if err != nil {
+		d.Result = "failed"
+		d.Error = Redact(err.Error())
+	}
+	path := cfg.StatePath(deliveriesFile)
+	if err := appendHistory(path, d); err != nil {
+		Logger(ctx).Error("保存推送记录失败", LogKeyPath, path, LogKeyError, err)
+	}
+}
@@ -0,0 +1,252 @@
+// Package internal 包含项目的核心功能实现
+// 该文件实现基于公开页面zh/index.html的备用数据来源，在JSON接口被拦截时使用
+package internal
+
+import (
+	"bytes"    // 用于读取响应体
+	"context"  // 用于取消和超时控制
+	"fmt"      // 用于格式化输出
+	"io"       // 用于读取页面内容
+	"net/http" // 用于HTTP请求
+	"os"       // 用于环境变量
+	"regexp"   // 用于提取阶段数字
+	"strconv"  // 用于字符串转换
+	"strings"  // 用于字符串处理
+	"time"     // 用于时间处理
+
+	"github.com/PuerkitoBio/goquery" // 用于解析HTML
+)
+
+// EndpointHTML 公开页面的接口名，对应config.json中retry字段的键
+const EndpointHTML = "html"
+
+// defaultHTMLURL 默认抓取的页面地址
+const defaultHTMLURL = "https://alpha123.uk/zh/index.html"
+
+// HTMLSourceConfig 页面抓取来源的配置
+type HTMLSourceConfig struct {
+	Enabled   bool          `json:"enabled"`   // 是否在JSON接口失败时抓取页面
+	URL       string        `json:"url"`       // 页面地址，默认为zh/index.html
+	Selectors HTMLSelectors `json:"selectors"` // 页面元素选择器，未设置的使用默认值
+}
+
+// HTMLSelectors 页面元素选择器
+// Item选中每个空投所在的元素，其余选择器在Item内部查找并取文本；
+// 写成"选择器@属性"时取属性值，只写"@属性"时取Item自身的属性
+type HTMLSelectors struct {
+	Item   string `json:"item"`   // 单个空投元素
+	Token  string `json:"token"`  // 代币符号
+	Name   string `json:"name"`   // 项目名称
+	Date   string `json:"date"`   // 日期，可以是"2025-09-08 18:00"这样的日期时间
+	Time   string `json:"time"`   // 时间
+	Points string `json:"points"` // 所需积分
+	Amount string `json:"amount"` // 空投数量
+	Type   string `json:"type"`   // 类型，包含tge时识别为TGE
+	Phase  string `json:"phase"`  // 阶段，取其中的数字
+}
+
+// defaultHTMLSelectors 默认选择器，页面改版后可在配置中覆盖
+var defaultHTMLSelectors = HTMLSelectors{
+	Item:   ".airdrop-item",
+	Token:  ".token",
+	Name:   ".name",
+	Date:   ".date",
+	Time:   ".time",
+	Points: ".points",
+	Amount: ".amount",
+	Type:   "@data-type",
+	Phase:  ".phase",
+}
+
+// withDefaults 返回补齐默认值后的选择器
+func (sel HTMLSelectors) withDefaults() HTMLSelectors {
+	fill := func(value *string, fallback string) {
+		if *value == "" {
+			*value = fallback
+		}
+	}
+	fill(&sel.Item, defaultHTMLSelectors.Item)
+	fill(&sel.Token, defaultHTMLSelectors.Token)
+	fill(&sel.Name, defaultHTMLSelectors.Name)
+	fill(&sel.Date, defaultHTMLSelectors.Date)
+	fill(&sel.Time, defaultHTMLSelectors.Time)
+	fill(&sel.Points, defaultHTMLSelectors.Points)
+	fill(&sel.Amount, defaultHTMLSelectors.Amount)
+	fill(&sel.Type, defaultHTMLSelectors.Type)
+	fill(&sel.Phase, defaultHTMLSelectors.Phase)
+	return sel
+}
+
+// HTMLSource 抓取公开页面的数据来源
+type HTMLSource struct {
+	url       string            // 页面地址
+	selectors HTMLSelectors     // 补齐默认值后的选择器
+	policy    RetryPolicy       // 重试策略
+	transport http.RoundTripper // 录制或回放时使用的Transport，nil表示默认
+	cookie    string            // CloudFlare验证Cookie，为空时不发送
+}
+
+// NewHTMLSource 创建页面抓取来源
+// 参数:
+//   - cfg: 配置信息，使用其中的htmlSource和retry.html
+//   - transport: 发送请求的Transport，为nil时使用默认Transport
+// 返回:
+//   - *HTMLSource: 页面抓取来源实例
+func NewHTMLSource(cfg *Config, transport http.RoundTripper) *HTMLSource {
+	var hc HTMLSourceConfig
+	if cfg != nil {
+		hc = cfg.HTMLSource
+	}
+	url := hc.URL
+	if url == "" {
+		url = defaultHTMLURL
+	}
+	return &HTMLSource{
+		url:       url,
+		selectors: hc.Selectors.withDefaults(),
+		policy:    cfg.RetryPolicyFor(EndpointHTML),
+		transport: transport,
+		cookie:    cfg.UpstreamCookie(),
+	}
+}
+
+// Name 返回来源名称
+func (h *HTMLSource) Name() string {
+	return SourceHTML
+}
+
+// Fetch 抓取页面并解析出空投列表
+// 参数:
+//   - ctx: 控制取消的上下文
+// 返回:
+//   - *ApiResponse: 解析出的空投列表
+//   - error: 所有尝试都失败时返回最后一次的错误
+func (h *HTMLSource) Fetch(ctx context.Context) (*ApiResponse, error) {
+	var lastErr error
+	for attempt := 1; attempt <= h.policy.MaxAttempts; attempt++ {
+		Logger(ctx).Info("抓取页面", LogKeySource, SourceHTML, LogKeyAttempt, attempt, LogKeyURL, h.url)
+		airdrops, resp, err := h.fetchOnce(ctx)
+		if err == nil {
+			return &ApiResponse{Airdrops: airdrops}, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lastErr = err
+		if attempt < h.policy.MaxAttempts {
+			if _, err := h.policy.Wait(ctx, attempt, resp); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, lastErr
+}
+
+// fetchOnce 请求一次页面并解析
+func (h *HTMLSource) fetchOnce(ctx context.Context) ([]Airdrop, *http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", h.url, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8") // 接受HTML
+	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9")                                       // 语言偏好
+	req.Header.Set("Accept-Encoding", "gzip")                                                 // 只声明readResponseBody能处理的压缩方式
+	if h.cookie != "" {
+		req.Header.Set("Cookie", h.cookie) // CloudFlare验证Cookie
+	}
+	userAgent := os.Getenv("USER_AGENT")
+	if userAgent == "" {
+		userAgent = "Mozilla/5.0 (Linux; Android 6.0; Nexus 5 Build/MRA58N) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/132.0.0.0 Mobile Safari/537.36"
+	}
+	req.Header.Set("User-Agent", userAgent) // 用户代理
+
+	client := &http.Client{Timeout: 30 * time.Second, Transport: instrumentTransport(h.transport, EndpointHTML)}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, resp, fmt.Errorf("页面请求失败，状态码: %d", resp.StatusCode)
+	}
+	body, err := readResponseBody(resp)
+	if err != nil {
+		return nil, resp, err
+	}
+	airdrops, err := parseAirdropHTML(bytes.NewReader(body), h.selectors)
+	return airdrops, resp, err
+}
+
+// phasePattern 从阶段文本中提取数字，如"Phase 2"、"第2阶段"
+var phasePattern = regexp.MustCompile(`\d+`)
+
+// parseAirdropHTML 按选择器从页面中解析空投列表
+// 参数:
+//   - r: 页面内容
+//   - sel: 补齐默认值后的选择器
+// 返回:
+//   - []Airdrop: 解析出的空投列表
+//   - error: 页面无法解析，或找不到任何空投元素时返回错误
+func parseAirdropHTML(r io.Reader, sel HTMLSelectors) ([]Airdrop, error) {
+	doc, err := goquery.NewDocumentFromReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	items := doc.Find(sel.Item)
+	if items.Length() == 0 {
+		// 页面可能被拦截或已改版，返回错误而不是空列表，避免被当作"所有空投都已删除"
+		return nil, fmt.Errorf("页面中没有匹配 %q 的元素", sel.Item)
+	}
+
+	var airdrops []Airdrop
+	items.Each(func(_ int, item *goquery.Selection) {
+		airdrop := Airdrop{
+			Token:  selectText(item, sel.Token),
+			Name:   selectText(item, sel.Name),
+			Date:   selectText(item, sel.Date),
+			Time:   selectText(item, sel.Time),
+			Amount: strings.ReplaceAll(selectText(item, sel.Amount), ",", ""),
+		}
+
+		// 日期列可能同时包含时间
+		if fields := strings.Fields(airdrop.Date); len(fields) == 2 && airdrop.Time == "" {
+			airdrop.Date, airdrop.Time = fields[0], fields[1]
+		}
+
+		if points := selectText(item, sel.Points); points != "" {
+			airdrop.Points = points
+		}
+
+		airdrop.Type = "airdrop"
+		if strings.Contains(strings.ToLower(selectText(item, sel.Type)), "tge") {
+			airdrop.Type = "tge"
+		}
+
+		// 没有阶段或阶段中没有数字时按上游的默认值第1阶段处理，否则合并时无法与JSON接口的同一空投对应
+		airdrop.Phase = 1
+		if digits := phasePattern.FindString(selectText(item, sel.Phase)); digits != "" {
+			if phase, err := strconv.Atoi(digits); err == nil && phase > 0 {
+				airdrop.Phase = phase
+			}
+		}
+
+		airdrops = append(airdrops, airdrop)
+	})
+	return airdrops, nil
+}
+
+// selectText 按"选择器@属性"的约定从元素中取值
+func selectText(item *goquery.Selection, selector string) string {
+	css, attr, hasAttr := strings.Cut(selector, "@")
+	target := item
+	if css != "" {
+		target = item.Find(css).First()
+	}
+	if hasAttr {
+		value, _ := target.Attr(attr)
+		return strings.TrimSpace(value)
+	}
+	return strings.TrimSpace(target.Text())
+}
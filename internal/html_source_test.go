@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+// loadFixture 打开testdata下保存的页面
+func loadFixture(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatalf("打开fixture失败: %v", err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestParseAirdropHTMLDefaultSelectors(t *testing.T) {
+	airdrops, err := parseAirdropHTML(loadFixture(t, "synthetic.html"), HTMLSelectors{}.withDefaults())
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(airdrops) != 2 {
+		t.Fatalf("期望2个空投，实际%d个", len(airdrops))
+	}
+
+	first := airdrops[0]
+	if first.Token != "ABC" || first.Name != "Alpha Beta" || first.Date != "2025-09-08" || first.Time != "18:00" {
+		t.Errorf("第一个空投解析错误: %+v", first)
+	}
+	if first.Points != "220" || first.Amount != "1500" || first.Phase != 1 || first.Type != "airdrop" {
+		t.Errorf("第一个空投的积分/数量/阶段/类型错误: %+v", first)
+	}
+
+	// 日期列包含时间时拆分到Time
+	second := airdrops[1]
+	if second.Date != "2025-09-09" || second.Time != "10:30" {
+		t.Errorf("日期时间拆分错误: date=%q time=%q", second.Date, second.Time)
+	}
+	if second.Type != "tge" || second.Phase != 2 {
+		t.Errorf("第二个空投的类型/阶段错误: type=%q phase=%d", second.Type, second.Phase)
+	}
+}
+
+func TestParseAirdropHTMLCustomSelectors(t *testing.T) {
+	sel := HTMLSelectors{
+		Item:   "#calendar tr",
+		Token:  ".c-token",
+		Name:   ".c-name",
+		Date:   ".c-when",
+		Time:   ".c-missing",
+		Points: ".c-points",
+		Amount: ".c-amount",
+		Type:   "@data-kind",
+		Phase:  ".c-phase@data-phase",
+	}.withDefaults()
+
+	airdrops, err := parseAirdropHTML(loadFixture(t, "synthetic.html"), sel)
+	if err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+	if len(airdrops) != 1 {
+		t.Fatalf("期望1个空投，实际%d个", len(airdrops))
+	}
+	got := airdrops[0]
+	if got.Token != "QQQ" || got.Date != "2025-09-10" || got.Time != "09:00" || got.Phase != 2 || got.Type != "tge" {
+		t.Errorf("自定义选择器解析错误: %+v", got)
+	}
+}
+
+// TestParseAirdropHTMLSavedPage 用保存的真实页面验证默认选择器
+// 页面不随仓库提交时跳过，更新方法：
+//
+//	curl -o internal/testdata/zh_index.html https://alpha123.uk/zh/index.html
+func TestParseAirdropHTMLSavedPage(t *testing.T) {
+	if _, err := os.Stat("testdata/zh_index.html"); os.IsNotExist(err) {
+		t.Skip("testdata/zh_index.html不存在，先保存alpha123的真实页面")
+	}
+	airdrops, err := parseAirdropHTML(loadFixture(t, "zh_index.html"), HTMLSelectors{}.withDefaults())
+	if err != nil {
+		t.Fatalf("默认选择器无法解析真实页面，需要按页面结构更新defaultHTMLSelectors: %v", err)
+	}
+	for _, a := range airdrops {
+		if a.Token == "" || a.Date == "" {
+			t.Errorf("真实页面中的空投缺少token或date: %+v", a)
+		}
+	}
+}
+
+func TestParseAirdropHTMLPhaseDefault(t *testing.T) {
+	cases := []struct {
+		name  string
+		phase string
+		want  int
+	}{
+		{"没有阶段", ``, 1},
+		{"阶段中没有数字", `<span class="phase">待定</span>`, 1},
+		{"阶段为0", `<span class="phase">Phase 0</span>`, 1},
+		{"第3阶段", `<span class="phase">第3阶段</span>`, 3},
+	}
+	for _, c := range cases {
+		page := `<div class="airdrop-item"><span class="token">ABC</span><span class="date">2025-09-08</span>` + c.phase + `</div>`
+		airdrops, err := parseAirdropHTML(strings.NewReader(page), HTMLSelectors{}.withDefaults())
+		if err != nil {
+			t.Fatalf("%s: 解析失败: %v", c.name, err)
+		}
+		if got := airdrops[0].Phase; got != c.want {
+			t.Errorf("%s: 期望阶段%d，实际%d", c.name, c.want, got)
+		}
+	}
+
+	// 与JSON接口的第1阶段空投应合并为同一个
+	api := []Airdrop{{Token: "ABC", Phase: 1}}
+	html, _ := parseAirdropHTML(strings.NewReader(`<div class="airdrop-item"><span class="token">ABC</span></div>`), HTMLSelectors{}.withDefaults())
+	merged := mergeAirdrops(context.Background(), []sourceResult{{"api", api}, {"html", html}}, MergeConfig{})
+	if len(merged) != 1 {
+		t.Errorf("没有阶段的页面空投应与接口的第1阶段合并，实际%d个", len(merged))
+	}
+}
+
+func TestParseAirdropHTMLNoItems(t *testing.T) {
+	// 被拦截的页面不应解析成空列表
+	page := `<html><body><h1>Just a moment...</h1></body></html>`
+	if _, err := parseAirdropHTML(strings.NewReader(page), HTMLSelectors{}.withDefaults()); err == nil {
+		t.Fatal("没有匹配元素时应返回错误")
+	}
+}
@@ -0,0 +1,181 @@
+// Package internal 包含项目的核心功能实现
+// 该文件把过滤后的空投导出为iCalendar（RFC 5545）日历，供手机日历订阅
+// 每个空投对应一个VEVENT，UID由代币和阶段生成，改期或数量变化时日历中的事件会被替换而不是重复
+package internal
+
+import (
+	"crypto/sha256" // 用于生成UID
+	"encoding/hex"  // 用于生成UID
+	"fmt"           // 用于格式化
+	"net/http"      // 用于日历订阅地址
+	"strings"       // 用于字符串处理
+	"time"          // 用于时间处理
+	"unicode"       // 用于生成UID
+)
+
+// icsTimeLayout iCalendar的本地时间格式，配合TZID使用
+const icsTimeLayout = "20060102T150405"
+
+// icsEventDuration 日历事件的时长，空投本身只有开始时间
+const icsEventDuration = 30 * time.Minute
+
+// icsLineLimit iCalendar内容行的最大字节数，超过时折行
+const icsLineLimit = 75
+
+// defaultCalendarAlarms 未配置alarms时的提醒时间（开始前多少分钟）
+var defaultCalendarAlarms = []int{15}
+
+// CalendarConfig 日历导出配置
+type CalendarConfig struct {
+	Alarms []int `json:"alarms"` // 开始前多少分钟提醒，可以有多个，默认15；配置为空数组[]时不提醒
+}
+
+// calendarAlarms 返回提醒时间，未配置时使用默认值
+func (c *Config) calendarAlarms() []int {
+	if c == nil || c.Calendar.Alarms == nil {
+		return defaultCalendarAlarms
+	}
+	return c.Calendar.Alarms
+}
+
+// eventUID 根据代币和阶段生成事件UID，同一空投每次导出都相同
+// UID以代币中的ASCII字母数字开头便于阅读，后接小写代币与阶段的哈希，中文等代币不会互相冲突
+func eventUID(token string, phase int) string {
+	lower := strings.ToLower(token)
+	var b strings.Builder
+	for _, r := range lower {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d", lower, phase)))
+	return fmt.Sprintf("%s-phase%d-%s@alpha_wx_notify", b.String(), phase, hex.EncodeToString(sum[:6]))
+}
+
+// escapeICSText 转义TEXT类型的值中的反斜杠、逗号、分号和换行
+func escapeICSText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// foldICSLine 按icsLineLimit折行，续行以空格开头，不在UTF-8字符中间断开
+func foldICSLine(line string) string {
+	if len(line) <= icsLineLimit {
+		return line + "\r\n"
+	}
+	var b strings.Builder
+	limit := icsLineLimit
+	width := 0
+	for _, r := range line {
+		n := len(string(r))
+		if width+n > limit {
+			b.WriteString("\r\n ")
+			width = 0
+			limit = icsLineLimit - 1 // 续行开头的空格也计入长度
+		}
+		b.WriteRune(r)
+		width += n
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// formatOffset 把时区偏移格式化为+0800形式
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
+
+// BuildCalendar 把空投生成为iCalendar文本
+// 开始时间使用配置的时区并附带VTIMEZONE；上游所在的Asia/Shanghai没有夏令时，VTIMEZONE只包含当前偏移
+// 参数:
+//   - cfg: 配置信息，提供时区和提醒时间
+//   - airdrops: 过滤后的空投，开始时间未知的会被跳过
+//   - now: 生成时间，写入DTSTAMP
+// 返回:
+//   - string: 以CRLF分隔的iCalendar文本
+func BuildCalendar(cfg *Config, airdrops []PricedAirdrop, now time.Time) string {
+	loc := cfg.Location()
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+
+	add("BEGIN:VCALENDAR")
+	add("VERSION:2.0")
+	add("PRODID:-//alpha_wx_notify//Alpha Airdrops//ZH")
+	add("CALSCALE:GREGORIAN")
+	add("METHOD:PUBLISH")
+	add("X-WR-CALNAME:Alpha空投")
+	add("X-WR-TIMEZONE:%s", loc.String())
+
+	tzName, offset := now.In(loc).Zone()
+	add("BEGIN:VTIMEZONE")
+	add("TZID:%s", loc.String())
+	add("BEGIN:STANDARD")
+	add("DTSTART:19700101T000000")
+	add("TZOFFSETFROM:%s", formatOffset(offset))
+	add("TZOFFSETTO:%s", formatOffset(offset))
+	add("TZNAME:%s", tzName)
+	add("END:STANDARD")
+	add("END:VTIMEZONE")
+
+	stamp := now.UTC().Format(icsTimeLayout) + "Z"
+	for _, a := range airdrops {
+		if a.StartsAt == nil {
+			continue
+		}
+		start := a.StartsAt.In(loc)
+
+		summary := fmt.Sprintf("%s(%s) 阶段%d", a.Token, a.Name, a.Phase)
+		if a.Type == "tge" {
+			summary += " (tge)"
+		}
+		description := fmt.Sprintf("代币: %s\n项目: %s\n积分: %s\n数量: %s\n阶段: %d",
+			a.Token, a.Name, pointsString(a.Points), a.Amount, a.Phase)
+		if a.PriceAvailable {
+			description += fmt.Sprintf("\n估值: %.2f USD", a.Value)
+		}
+
+		add("BEGIN:VEVENT")
+		add("UID:%s", eventUID(a.Token, a.Phase))
+		add("DTSTAMP:%s", stamp)
+		add("DTSTART;TZID=%s:%s", loc.String(), start.Format(icsTimeLayout))
+		add("DTEND;TZID=%s:%s", loc.String(), start.Add(icsEventDuration).Format(icsTimeLayout))
+		add("SUMMARY:%s", escapeICSText(summary))
+		add("DESCRIPTION:%s", escapeICSText(description))
+		for _, minutes := range cfg.calendarAlarms() {
+			add("BEGIN:VALARM")
+			add("ACTION:DISPLAY")
+			add("DESCRIPTION:%s", escapeICSText(summary))
+			add("TRIGGER:-PT%dM", minutes)
+			add("END:VALARM")
+		}
+		add("END:VEVENT")
+	}
+	add("END:VCALENDAR")
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(foldICSLine(line))
+	}
+	return b.String()
+}
+
+// CalendarHandler 返回/calendar.ics处理器，内容为daemon最近一次检查的结果
+// 参数:
+//   - config: 配置信息
+//   - service: daemon使用的空投服务
+// 返回:
+//   - http.HandlerFunc: 日历订阅处理器
+func CalendarHandler(config *Config, service *AirdropService) http.HandlerFunc {
+	return readOnly(func(w http.ResponseWriter, _ *http.Request) {
+		view := service.View()
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		w.Header().Set("Content-Disposition", `inline; filename="alpha_airdrops.ics"`)
+		w.Write([]byte(BuildCalendar(config, view.Airdrops, time.Now())))
+	})
+}
@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventUID(t *testing.T) {
+	cases := []struct {
+		name       string
+		a, b       string
+		phaseA     int
+		phaseB     int
+		wantSame   bool
+		wantPrefix string // a的UID的可读前缀
+	}{
+		{"大小写不同也是同一个事件", "ABC", "abc", 1, 1, true, "abc-phase1-"},
+		{"阶段不同", "ABC", "ABC", 1, 2, false, "abc-phase1-"},
+		{"长度相同的中文代币", "币安", "火币", 1, 1, false, "-phase1-"},
+		{"只有符号不同", "AB C", "AB.C", 1, 1, false, "abc-phase1-"},
+	}
+	for _, c := range cases {
+		uidA, uidB := eventUID(c.a, c.phaseA), eventUID(c.b, c.phaseB)
+		if (uidA == uidB) != c.wantSame {
+			t.Errorf("%s: %q=%s，%q=%s", c.name, c.a, uidA, c.b, uidB)
+		}
+		if !strings.HasPrefix(uidA, c.wantPrefix) || !strings.HasSuffix(uidA, "@alpha_wx_notify") {
+			t.Errorf("%s: UID格式错误: %s", c.name, uidA)
+		}
+		if uidA != eventUID(c.a, c.phaseA) {
+			t.Errorf("%s: 同一空投每次生成的UID应相同", c.name)
+		}
+	}
+}
+
+func TestEscapeICSText(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{`a\b`, `a\\b`},
+		{"a,b;c", `a\,b\;c`},
+		{"a\nb\r\nc", `a\nb\nc`},
+	}
+	for _, c := range cases {
+		if got := escapeICSText(c.in); got != c.want {
+			t.Errorf("%q: 期望%q，实际%q", c.in, c.want, got)
+		}
+	}
+}
+
+func TestFoldICSLine(t *testing.T) {
+	cases := []struct {
+		name string
+		line string
+	}{
+		{"不需要折行", strings.Repeat("a", icsLineLimit)},
+		{"ASCII折行", strings.Repeat("a", 200)},
+		{"中文不在字符中间断开", "SUMMARY:" + strings.Repeat("空投", 40)},
+	}
+	for _, c := range cases {
+		got := foldICSLine(c.line)
+		if !strings.HasSuffix(got, "\r\n") {
+			t.Errorf("%s: 应以CRLF结尾", c.name)
+		}
+		lines := strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n")
+		for i, line := range lines {
+			if len(line) > icsLineLimit {
+				t.Errorf("%s: 第%d行超过%d字节: %d", c.name, i+1, icsLineLimit, len(line))
+			}
+			if i > 0 && !strings.HasPrefix(line, " ") {
+				t.Errorf("%s: 续行应以空格开头: %q", c.name, line)
+			}
+		}
+		// 去掉折行后应还原为原来的内容
+		if unfolded := strings.ReplaceAll(strings.TrimSuffix(got, "\r\n"), "\r\n ", ""); unfolded != c.line {
+			t.Errorf("%s: 还原后与原内容不同: %q", c.name, unfolded)
+		}
+	}
+}
+
+func TestFormatOffset(t *testing.T) {
+	cases := []struct {
+		seconds int
+		want    string
+	}{
+		{0, "+0000"},
+		{8 * 3600, "+0800"},
+		{5*3600 + 1800, "+0530"},
+		{-(3*3600 + 1800), "-0330"},
+	}
+	for _, c := range cases {
+		if got := formatOffset(c.seconds); got != c.want {
+			t.Errorf("%d秒: 期望%s，实际%s", c.seconds, c.want, got)
+		}
+	}
+}
+
+func TestBuildCalendar(t *testing.T) {
+	now := time.Date(2025, 9, 10, 4, 0, 0, 0, time.UTC)
+	start := time.Date(2025, 9, 10, 10, 0, 0, 0, time.UTC)
+	airdrops := []PricedAirdrop{
+		{
+			Airdrop:        Airdrop{Token: "ABC", Name: "Alpha, Beta", Phase: 1, Points: "200", Amount: "1,000", Type: "tge"},
+			Value:          12.5,
+			PriceAvailable: true,
+			StartsAt:       &start,
+		},
+		{Airdrop: Airdrop{Token: "XYZ", Name: "未知时间", Phase: 1}}, // 没有开始时间，跳过
+	}
+
+	cases := []struct {
+		name    string
+		cfg     *Config
+		want    []string
+		notWant []string
+	}{
+		{
+			name: "默认提醒",
+			cfg:  &Config{Timezone: "UTC"},
+			want: []string{
+				"BEGIN:VCALENDAR\r\n",
+				"TZID:UTC\r\n",
+				"TZOFFSETTO:+0000\r\n",
+				"UID:" + eventUID("ABC", 1) + "\r\n",
+				"DTSTAMP:20250910T040000Z\r\n",
+				"DTSTART;TZID=UTC:20250910T100000\r\n",
+				"DTEND;TZID=UTC:20250910T103000\r\n",
+				`SUMMARY:ABC(Alpha\, Beta) 阶段1 (tge)` + "\r\n",
+				"TRIGGER:-PT15M\r\n",
+				"END:VCALENDAR\r\n",
+			},
+			notWant: []string{"XYZ"},
+		},
+		{
+			name:    "多个提醒",
+			cfg:     &Config{Timezone: "UTC", Calendar: CalendarConfig{Alarms: []int{60, 5}}},
+			want:    []string{"TRIGGER:-PT60M\r\n", "TRIGGER:-PT5M\r\n"},
+			notWant: []string{"TRIGGER:-PT15M"},
+		},
+		{
+			name:    "配置为空数组时不提醒",
+			cfg:     &Config{Timezone: "UTC", Calendar: CalendarConfig{Alarms: []int{}}},
+			notWant: []string{"BEGIN:VALARM"},
+		},
+	}
+	for _, c := range cases {
+		// 折行后的内容先还原，便于按行查找
+		ics := strings.ReplaceAll(BuildCalendar(c.cfg, airdrops, now), "\r\n ", "")
+		for _, want := range c.want {
+			if !strings.Contains(ics, want) {
+				t.Errorf("%s: 缺少%q", c.name, strings.TrimSpace(want))
+			}
+		}
+		for _, notWant := range c.notWant {
+			if strings.Contains(ics, notWant) {
+				t.Errorf("%s: 不应包含%q", c.name, notWant)
+			}
+		}
+		if n := strings.Count(ics, "BEGIN:VEVENT"); n != 1 {
+			t.Errorf("%s: 期望1个事件，实际%d个", c.name, n)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package internal 包含项目的核心功能实现
+// 该文件实现Alpha积分账本：按成员记录每天的余额档位、交易量档位积分和领取空投消耗的积分，
+// 计算最近15天的滚动积分，用于判断是否达到各空投的积分门槛
+package internal
+
+import (
+	"encoding/json" // 用于账本的编解码
+	"fmt"           // 用于格式化
+	"math"          // 用于交易量档位计算
+	"os"            // 用于读写账本
+	"sort"          // 用于排列成员和日期
+	"strings"       // 用于拼接报告
+	"time"          // 用于日期计算
+)
+
+// ledgerFile 积分账本文件名，位于状态目录下
+const ledgerFile = "points_ledger.json"
+
+// LedgerWindowDays 滚动积分统计的天数，包含今天
+const LedgerWindowDays = 15
+
+// ledgerRetentionDays 账本保留的天数，超过的记录在保存时清理
+const ledgerRetentionDays = 30
+
+// 账本记录的类型
+const (
+	LedgerBalance = "balance" // 当天的余额档位积分，每天一条，重复添加时覆盖
+	LedgerVolume  = "volume"  // 当天的交易量档位积分，每天一条，重复添加时覆盖
+	LedgerSpend   = "spend"   // 领取空投消耗的积分，可以有多条
+)
+
+// LedgerEntry 账本中的一条记录
+type LedgerEntry struct {
+	Date   string  `json:"date"`          // 日期，格式为2006-01-02，按配置的时区
+	Kind   string  `json:"kind"`          // LedgerBalance、LedgerVolume或LedgerSpend
+	USD    float64 `json:"usd,omitempty"` // 余额或交易量（美元），spend为0
+	Points int     `json:"points"`        // 积分，spend为消耗的积分（正数）
+}
+
+// Ledger 积分账本，键为成员名
+type Ledger map[string][]LedgerEntry
+
+// BalanceTierPoints 按余额（美元）计算当天的余额档位积分
+// 100以上1分，1000以上2分，10000以上3分，100000以上4分
+func BalanceTierPoints(usd float64) int {
+	points := 0
+	for _, tier := range []float64{100, 1000, 10000, 100000} {
+		if usd >= tier {
+			points++
+		}
+	}
+	return points
+}
+
+// VolumeTierPoints 按交易量（美元）计算当天的交易量档位积分
+// 2美元1分，之后交易量每翻一倍加1分
+func VolumeTierPoints(usd float64) int {
+	if usd < 2 {
+		return 0
+	}
+	return int(math.Floor(math.Log2(usd)))
+}
+
+// LoadLedger 读取积分账本
+// 参数:
+//   - cfg: 配置信息，用于定位状态目录
+// 返回:
+//   - Ledger: 积分账本，文件不存在时为空
+//   - error: 读取或解析失败时返回错误
+func LoadLedger(cfg *Config) (Ledger, error) {
+	ledger := make(Ledger)
+	data, err := os.ReadFile(cfg.StatePath(ledgerFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return ledger, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &ledger); err != nil {
+		return nil, fmt.Errorf("解析积分账本失败: %v", err)
+	}
+	return ledger, nil
+}
+
+// SaveLedger 保存积分账本，早于ledgerRetentionDays天的记录不再保留
+// 参数:
+//   - cfg: 配置信息，用于定位状态目录
+//   - ledger: 积分账本
+//   - today: 今天，用于清理旧记录
+// 返回:
+//   - error: 写入失败时返回错误
+func SaveLedger(cfg *Config, ledger Ledger, today time.Time) error {
+	oldest := today.AddDate(0, 0, -ledgerRetentionDays).Format("2006-01-02")
+	for member, entries := range ledger {
+		kept := entries[:0]
+		for _, e := range entries {
+			if e.Date >= oldest {
+				kept = append(kept, e)
+			}
+		}
+		ledger[member] = kept
+	}
+	data, err := json.MarshalIndent(ledger, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(cfg.StatePath(ledgerFile), data, 0644)
+}
+
+// Add 添加一条记录，余额和交易量每天只保留最后一条
+// 参数:
+//   - member: 成员名
+//   - e: 记录
+func (l Ledger) Add(member string, e LedgerEntry) {
+	entries := l[member]
+	if e.Kind != LedgerSpend {
+		for i, old := range entries {
+			if old.Date == e.Date && old.Kind == e.Kind {
+				entries[i] = e
+				return
+			}
+		}
+	}
+	l[member] = append(entries, e)
+}
+
+// windowStart 滚动窗口第一天的日期
+func windowStart(today time.Time) string {
+	return today.AddDate(0, 0, 1-LedgerWindowDays).Format("2006-01-02")
+}
+
+// Score 计算成员最近15天（包含今天）的滚动积分：获得的积分减去消耗的积分，不低于0
+// 参数:
+//   - member: 成员名
+//   - today: 今天，按配置的时区
+// 返回:
+//   - int: 滚动积分
+//   - bool: 账本中是否有该成员
+func (l Ledger) Score(member string, today time.Time) (int, bool) {
+	entries, ok := l[member]
+	if !ok {
+		return 0, false
+	}
+	from, to := windowStart(today), today.Format("2006-01-02")
+	score := 0
+	for _, e := range entries {
+		if e.Date < from || e.Date > to {
+			continue
+		}
+		if e.Kind == LedgerSpend {
+			score -= e.Points
+		} else {
+			score += e.Points
+		}
+	}
+	return max(score, 0), true
+}
+
+// Members 返回按名字排序的成员列表
+func (l Ledger) Members() []string {
+	members := make([]string, 0, len(l))
+	for m := range l {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// LedgerReport 生成成员滚动积分的文本报告，列出窗口内每天的积分
+// 参数:
+//   - l: 积分账本
+//   - members: 要输出的成员
+//   - today: 今天，按配置的时区
+// 返回:
+//   - string: 报告内容
+func LedgerReport(l Ledger, members []string, today time.Time) string {
+	var b strings.Builder
+	from := windowStart(today)
+	for _, member := range members {
+		score, _ := l.Score(member, today)
+		fmt.Fprintf(&b, "%s：最近%d天积分 %d\n", member, LedgerWindowDays, score)
+
+		type day struct{ balance, volume, spend int }
+		days := make(map[string]*day)
+		for _, e := range l[member] {
+			if e.Date < from {
+				continue
+			}
+			d := days[e.Date]
+			if d == nil {
+				d = &day{}
+				days[e.Date] = d
+			}
+			switch e.Kind {
+			case LedgerBalance:
+				d.balance = e.Points
+			case LedgerVolume:
+				d.volume = e.Points
+			case LedgerSpend:
+				d.spend += e.Points
+			}
+		}
+		dates := make([]string, 0, len(days))
+		for date := range days {
+			dates = append(dates, date)
+		}
+		sort.Strings(dates)
+		b.WriteString("  日期        余额  交易  消耗  合计\n") // 中文按两个字符宽度对齐
+		for _, date := range dates {
+			d := days[date]
+			fmt.Fprintf(&b, "  %-10s  %4d  %4d  %4d  %4d\n", date, d.balance, d.volume, d.spend, d.balance+d.volume-d.spend)
+		}
+		// 明天滑出窗口的积分，方便判断是否需要补交易
+		if d := days[from]; d != nil {
+			fmt.Fprintf(&b, "  明天将过期：%d\n", d.balance+d.volume-d.spend)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// EligibilityReport 生成各成员对当前空投的资格报告
+// 参数:
+//   - l: 积分账本
+//   - airdrops: 当前窗口内的空投
+//   - today: 今天，按配置的时区
+// 返回:
+//   - string: Markdown表格，每个成员一列
+func EligibilityReport(l Ledger, airdrops []PricedAirdrop, today time.Time) string {
+	members := l.Members()
+	scores := make([]int, len(members))
+	header, line := "| 项目 | 时间 | 积分 |", "|---|---|---|"
+	for i, m := range members {
+		scores[i], _ = l.Score(m, today)
+		header += fmt.Sprintf(" %s(%d) |", m, scores[i])
+		line += "---|"
+	}
+	msg := header + "\n" + line + "\n"
+	for _, a := range airdrops {
+		points := pointsString(a.Points)
+		msg += fmt.Sprintf("| %s(%s) | %s %s | %s |", a.Token, a.Name, a.Date, a.Time, points)
+		for _, score := range scores {
+			msg += " " + eligibilityMark(points, score) + " |"
+		}
+		msg += "\n"
+	}
+	return msg
+}
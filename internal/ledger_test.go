@@ -0,0 +1,109 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBalanceTierPoints(t *testing.T) {
+	cases := []struct {
+		usd  float64
+		want int
+	}{
+		{0, 0},
+		{99.99, 0},
+		{100, 1},
+		{999, 1},
+		{1000, 2},
+		{10000, 3},
+		{100000, 4},
+		{5000000, 4},
+	}
+	for _, c := range cases {
+		if got := BalanceTierPoints(c.usd); got != c.want {
+			t.Errorf("余额%v: 期望%d分，实际%d分", c.usd, c.want, got)
+		}
+	}
+}
+
+func TestVolumeTierPoints(t *testing.T) {
+	cases := []struct {
+		usd  float64
+		want int
+	}{
+		{0, 0},
+		{1.99, 0},
+		{2, 1},
+		{3.99, 1},
+		{4, 2},
+		{1024, 10},
+		{65535, 15},
+		{65536, 16},
+	}
+	for _, c := range cases {
+		if got := VolumeTierPoints(c.usd); got != c.want {
+			t.Errorf("交易量%v: 期望%d分，实际%d分", c.usd, c.want, got)
+		}
+	}
+}
+
+func TestLedgerAdd(t *testing.T) {
+	l := make(Ledger)
+	l.Add("alice", LedgerEntry{Date: "2025-09-10", Kind: LedgerBalance, Points: 2})
+	l.Add("alice", LedgerEntry{Date: "2025-09-10", Kind: LedgerBalance, Points: 3})
+	l.Add("alice", LedgerEntry{Date: "2025-09-10", Kind: LedgerVolume, Points: 10})
+	l.Add("alice", LedgerEntry{Date: "2025-09-10", Kind: LedgerSpend, Points: 15})
+	l.Add("alice", LedgerEntry{Date: "2025-09-10", Kind: LedgerSpend, Points: 15})
+
+	if got := len(l["alice"]); got != 4 {
+		t.Fatalf("同一天的余额应覆盖、消耗应累加，期望4条记录，实际%d条: %+v", got, l["alice"])
+	}
+	if got := l["alice"][0].Points; got != 3 {
+		t.Errorf("余额档位应为最后一次添加的3分，实际%d分", got)
+	}
+}
+
+func TestLedgerScore(t *testing.T) {
+	today := time.Date(2025, 9, 15, 10, 0, 0, 0, time.UTC)
+	cases := []struct {
+		name    string
+		entries []LedgerEntry
+		want    int
+	}{
+		{"余额和交易量相加", []LedgerEntry{
+			{Date: "2025-09-15", Kind: LedgerBalance, Points: 2},
+			{Date: "2025-09-15", Kind: LedgerVolume, Points: 14},
+		}, 16},
+		// 窗口为9月1日到9月15日
+		{"只统计最近15天", []LedgerEntry{
+			{Date: "2025-08-31", Kind: LedgerBalance, Points: 100},
+			{Date: "2025-09-01", Kind: LedgerBalance, Points: 3},
+			{Date: "2025-09-16", Kind: LedgerBalance, Points: 100},
+		}, 3},
+		{"减去消耗的积分", []LedgerEntry{
+			{Date: "2025-09-10", Kind: LedgerVolume, Points: 40},
+			{Date: "2025-09-12", Kind: LedgerSpend, Points: 15},
+			{Date: "2025-09-13", Kind: LedgerSpend, Points: 15},
+		}, 10},
+		{"窗口外的消耗不再扣除", []LedgerEntry{
+			{Date: "2025-08-20", Kind: LedgerSpend, Points: 15},
+			{Date: "2025-09-10", Kind: LedgerVolume, Points: 10},
+		}, 10},
+		{"不低于0", []LedgerEntry{
+			{Date: "2025-09-10", Kind: LedgerVolume, Points: 5},
+			{Date: "2025-09-11", Kind: LedgerSpend, Points: 15},
+		}, 0},
+		{"成员存在但没有记录", []LedgerEntry{}, 0},
+	}
+	for _, c := range cases {
+		l := Ledger{"alice": c.entries}
+		got, ok := l.Score("alice", today)
+		if !ok || got != c.want {
+			t.Errorf("%s: 期望(%d, true)，实际(%d, %v)", c.name, c.want, got, ok)
+		}
+	}
+
+	if got, ok := (Ledger{}).Score("bob", today); ok || got != 0 {
+		t.Errorf("账本中没有的成员应返回(0, false)，实际(%d, %v)", got, ok)
+	}
+}
@@ -0,0 +1,146 @@
+// Package internal 包含项目的核心功能实现
+// 该文件负责结构化日志：基于log/slog输出带级别的日志，
+// 日志消息保持固定文本，变化的内容放在固定的键中，便于检索和接入日志系统
+package internal
+
+import (
+	"context"      // 用于在检查周期内传递cycle_id
+	"crypto/rand"  // 用于生成cycle_id
+	"crypto/sha1"  // 用于生成接收人标识
+	"encoding/hex" // 用于编码标识
+	"io"           // 用于指定日志输出
+	"log/slog"     // 结构化日志
+	"os"           // 用于读取环境变量
+	"strings"      // 用于字符串处理
+)
+
+// 日志中固定使用的键
+const (
+	LogKeyCycleID   = "cycle_id"    // 单次检查周期的标识
+	LogKeySource    = "source"      // 数据来源：api、html、cache等
+	LogKeyAttempt   = "attempt"     // 第几次尝试
+	LogKeyStatus    = "status"      // HTTP状态码或状态名
+	LogKeyToken     = "token"       // 代币符号
+	LogKeyRecipient = "recipient"   // 推送接收人（SendKey的脱敏标识）
+	LogKeyError     = "err"         // 错误信息
+	LogKeyURL       = "url"         // 请求地址
+	LogKeyPath      = "path"        // 文件路径
+	LogKeyCount     = "count"       // 数量
+	LogKeyDelay     = "delay"       // 等待时长
+	LogKeyDuration  = "duration_ms" // 耗时（毫秒）
+)
+
+// 日志格式
+const (
+	LogFormatText = "text" // key=value格式，适合直接阅读
+	LogFormatJSON = "json" // 每行一个JSON对象，适合接入日志系统
+)
+
+// 日志配置的环境变量，优先于配置文件
+const (
+	EnvLogLevel  = "LOG_LEVEL"
+	EnvLogFormat = "LOG_FORMAT"
+)
+
+// maxLoggedBody debug级别下最多输出的响应体长度
+const maxLoggedBody = 2048
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level  string `json:"level"`  // debug、info、warn、error，默认info
+	Format string `json:"format"` // text或json，默认text
+}
+
+// parseLogLevel 解析日志级别，无法识别时返回info
+func parseLogLevel(s string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// SetupLogging 按配置创建slog处理器并设为默认
+// 环境变量LOG_LEVEL、LOG_FORMAT优先于配置；输出经过脱敏，标准库log的输出也会转到slog
+// 参数:
+//   - cfg: 日志配置
+//   - w: 日志输出位置，通常为os.Stderr
+func SetupLogging(cfg LogConfig, w io.Writer) {
+	if v := os.Getenv(EnvLogLevel); v != "" {
+		cfg.Level = v
+	}
+	if v := os.Getenv(EnvLogFormat); v != "" {
+		cfg.Format = v
+	}
+
+	opts := &slog.HandlerOptions{Level: parseLogLevel(cfg.Level)}
+	out := NewRedactingWriter(w)
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Format, LogFormatJSON) {
+		handler = slog.NewJSONHandler(out, opts)
+	} else {
+		handler = slog.NewTextHandler(out, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+}
+
+// cycleIDKey context中保存cycle_id的键
+type cycleIDKey struct{}
+
+// NewCycleContext 为一次检查周期生成cycle_id并放入ctx
+// 参数:
+//   - ctx: 父上下文
+// 返回:
+//   - context.Context: 带cycle_id的上下文
+//   - string: 生成的cycle_id
+func NewCycleContext(ctx context.Context) (context.Context, string) {
+	b := make([]byte, 4)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	return context.WithValue(ctx, cycleIDKey{}, id), id
+}
+
+// Logger 返回带有ctx中cycle_id的日志记录器
+// 参数:
+//   - ctx: 上下文，可以为nil
+// 返回:
+//   - *slog.Logger: 日志记录器，ctx中没有cycle_id时为默认记录器
+func Logger(ctx context.Context) *slog.Logger {
+	if id := cycleID(ctx); id != "" {
+		return slog.Default().With(LogKeyCycleID, id)
+	}
+	return slog.Default()
+}
+
+// cycleID 返回ctx中的cycle_id，ctx为nil或不在检查周期内时为空字符串
+func cycleID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(cycleIDKey{}).(string)
+	return id
+}
+
+// recipientLabel 返回SendKey在日志中的标识
+// 保留前4个字符并附加哈希，既不暴露密钥，又能区分不同接收人
+func recipientLabel(sendkey string) string {
+	sum := sha1.Sum([]byte(sendkey))
+	prefix := sendkey
+	if len(prefix) > 4 {
+		prefix = prefix[:4]
+	}
+	return prefix + "-" + hex.EncodeToString(sum[:3])
+}
+
+// truncateForLog 截断过长的文本，用于debug级别输出响应体
+func truncateForLog(b []byte) string {
+	if len(b) <= maxLoggedBody {
+		return string(b)
+	}
+	return string(b[:maxLoggedBody]) + "...(已截断)"
+}
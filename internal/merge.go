@@ -0,0 +1,267 @@
+// Package internal 包含项目的核心功能实现
+// 该文件负责把多个数据来源的空投列表合并为一份，并记录字段来源和来源之间的冲突
+package internal
+
+import (
+	"context" // 用于取消和超时控制
+	"fmt"     // 用于格式化输出
+	"sort"    // 用于排序
+	"strings" // 用于字符串处理
+)
+
+// MergeConfig 多来源合并配置
+// Sources非空时同时获取所有来源并合并，否则按api、html的顺序回退
+type MergeConfig struct {
+	Sources       []string            `json:"sources"`       // 参与合并的来源，排列顺序即默认优先级，如["api","html","manual"]
+	FieldPriority map[string][]string `json:"fieldPriority"` // 按字段覆盖来源优先级，如{"time": ["manual","api"]}
+	ManualFile    string              `json:"manualFile"`    // manual来源的文件路径，默认为状态目录下的manual_airdrops.json
+}
+
+// mergeFields 参与合并的字段，键为字段名，值为读写该字段的函数
+var mergeFields = []struct {
+	name string
+	get  func(*Airdrop) string
+	set  func(dst, src *Airdrop)
+}{
+	{"name", func(a *Airdrop) string { return a.Name }, func(d, s *Airdrop) { d.Name = s.Name }},
+	{"date", func(a *Airdrop) string { return a.Date }, func(d, s *Airdrop) { d.Date = s.Date }},
+	{"time", func(a *Airdrop) string { return a.Time }, func(d, s *Airdrop) { d.Time = s.Time }},
+	{"points", func(a *Airdrop) string { return pointsString(a.Points) }, func(d, s *Airdrop) { d.Points = s.Points }},
+	{"amount", func(a *Airdrop) string { return a.Amount }, func(d, s *Airdrop) { d.Amount = s.Amount }},
+	{"type", func(a *Airdrop) string { return a.Type }, func(d, s *Airdrop) { d.Type = s.Type }},
+	{"status", func(a *Airdrop) string { return a.Status }, func(d, s *Airdrop) { d.Status = s.Status }},
+	{"contract_address", func(a *Airdrop) string { return a.ContractAddress }, func(d, s *Airdrop) { d.ContractAddress = s.ContractAddress }},
+	{"chain_id", func(a *Airdrop) string { return a.ChainID }, func(d, s *Airdrop) { d.ChainID = s.ChainID }},
+}
+
+// conflictFields 来源之间取值不同时需要标记冲突的字段
+var conflictFields = map[string]bool{"date": true, "time": true, "amount": true}
+
+// sourceResult 单个来源的获取结果
+type sourceResult struct {
+	name     string
+	airdrops []Airdrop
+}
+
+// fetchMerged 获取配置中的所有来源并合并
+// 至少需要一个上游来源（非manual）成功，否则只有手工数据的列表会被误判为大量删除
+// 参数:
+//   - ctx: 控制取消的上下文
+// 返回:
+//   - *ApiResponse: 合并后的空投列表，上游来源全部失败时返回nil
+//   - string: 成功的来源名称，用"+"连接
+func (s *AirdropService) fetchMerged(ctx context.Context) (*ApiResponse, string) {
+	logger := Logger(ctx)
+	var results []sourceResult
+	var names []string
+	upstreamOK := false
+
+	for _, name := range s.config.Merge.Sources {
+		if ctx.Err() != nil {
+			return nil, ""
+		}
+		source := s.sourceByName(name)
+		if source == nil {
+			logger.Warn("未知的数据来源", LogKeySource, name)
+			continue
+		}
+		resp, err := source.Fetch(ctx)
+		if err != nil {
+			logger.Warn("数据来源获取失败", LogKeySource, name, LogKeyError, err)
+			continue
+		}
+		if name == SourceHTML {
+			if issues := s.checkResponseSanity(ctx, resp); len(issues) > 0 {
+				logger.Warn("数据来源的结果可疑，已忽略", LogKeySource, name, "reasons", strings.Join(issueReasons(issues), "; "))
+				continue
+			}
+		}
+		if name != SourceManual {
+			upstreamOK = true
+		}
+		results = append(results, sourceResult{name: name, airdrops: resp.Airdrops})
+		names = append(names, name)
+	}
+
+	if !upstreamOK {
+		return nil, ""
+	}
+	merged := mergeAirdrops(ctx, results, s.config.Merge)
+	logger.Info("已合并多个来源的数据", LogKeySource, strings.Join(names, "+"), LogKeyCount, len(merged))
+	return &ApiResponse{Airdrops: merged}, strings.Join(names, "+")
+}
+
+// sameAirdrop 判断两个来源中的记录是否是同一个空投
+// 阶段相同，且合约地址相同或代币符号相同（忽略大小写）
+func sameAirdrop(a, b *Airdrop) bool {
+	if a.Phase != b.Phase {
+		return false
+	}
+	if a.ContractAddress != "" && b.ContractAddress != "" {
+		return strings.EqualFold(a.ContractAddress, b.ContractAddress)
+	}
+	return a.Token != "" && strings.EqualFold(a.Token, b.Token)
+}
+
+// mergeAirdrops 合并多个来源的空投列表
+// 每个字段取优先级最高且有值的来源；日期、时间、数量在来源之间不一致时记录冲突
+// 同一来源中重复的空投（相同阶段和代币或合约地址）不会互相覆盖，各自作为一个空投保留，并打印警告
+// 参数:
+//   - ctx: 上下文，用于日志中的cycle_id
+//   - results: 各来源的结果，顺序即默认优先级
+//   - cfg: 合并配置，用于按字段覆盖优先级
+// 返回:
+//   - []Airdrop: 合并后的空投列表，填写了Sources、Provenance和Conflicts
+func mergeAirdrops(ctx context.Context, results []sourceResult, cfg MergeConfig) []Airdrop {
+	// 先把同一个空投在各来源中的记录分组
+	type group struct {
+		records map[string]*Airdrop // 来源名 -> 记录
+		order   []string            // 出现该记录的来源，按默认优先级
+	}
+	var groups []*group
+	for _, result := range results {
+		for i := range result.airdrops {
+			record := &result.airdrops[i]
+			var target *group
+			duplicate := false
+			for _, g := range groups {
+				if _, ok := g.records[result.name]; ok {
+					// 该组已有本来源的记录，同一来源的重复项另起一组
+					for _, existing := range g.records {
+						if sameAirdrop(existing, record) {
+							duplicate = true
+							break
+						}
+					}
+					continue
+				}
+				for _, existing := range g.records {
+					if sameAirdrop(existing, record) {
+						target = g
+						break
+					}
+				}
+				if target != nil {
+					break
+				}
+			}
+			if duplicate {
+				Logger(ctx).Warn("来源中有重复的空投，分别保留", LogKeySource, result.name, LogKeyToken, record.Token, "phase", record.Phase)
+			}
+			if target == nil {
+				target = &group{records: make(map[string]*Airdrop)}
+				groups = append(groups, target)
+			}
+			target.order = append(target.order, result.name)
+			target.records[result.name] = record
+		}
+	}
+
+	merged := make([]Airdrop, 0, len(groups))
+	for _, g := range groups {
+		// 非合并字段（代币、阶段等）取默认优先级最高的来源
+		item := *g.records[g.order[0]]
+		item.Sources = append([]string(nil), g.order...)
+		item.Provenance = make(map[string]string)
+		item.Conflicts = nil
+
+		for _, field := range mergeFields {
+			priority := g.order
+			if custom, ok := cfg.FieldPriority[field.name]; ok {
+				priority = orderByPriority(g.order, custom)
+			}
+
+			var chosen string
+			values := make(map[string]string) // 来源 -> 取值，用于检测冲突
+			for _, name := range priority {
+				value := strings.TrimSpace(field.get(g.records[name]))
+				if value == "" {
+					continue
+				}
+				values[name] = value
+				if chosen == "" {
+					chosen = name
+					field.set(&item, g.records[name])
+				}
+			}
+			if chosen != "" {
+				item.Provenance[field.name] = chosen
+			}
+
+			if conflictFields[field.name] && distinctValues(values) > 1 {
+				item.Conflicts = append(item.Conflicts, describeConflict(field.name, priority, values))
+			}
+		}
+		merged = append(merged, item)
+	}
+	return merged
+}
+
+// orderByPriority 按自定义优先级重排来源，未列出的来源保持原顺序排在最后
+func orderByPriority(present []string, custom []string) []string {
+	rank := make(map[string]int)
+	for i, name := range custom {
+		rank[name] = i
+	}
+	ordered := append([]string(nil), present...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ri, okI := rank[ordered[i]]
+		rj, okJ := rank[ordered[j]]
+		if okI != okJ {
+			return okI
+		}
+		return okI && ri < rj
+	})
+	return ordered
+}
+
+// distinctValues 统计不同取值的个数，数量中的千分位逗号不算差异
+func distinctValues(values map[string]string) int {
+	seen := make(map[string]bool)
+	for _, v := range values {
+		seen[strings.ReplaceAll(v, ",", "")] = true
+	}
+	return len(seen)
+}
+
+// describeConflict 生成冲突说明，如"time: api=18:00, html=19:00"
+func describeConflict(field string, order []string, values map[string]string) string {
+	var parts []string
+	for _, name := range order {
+		if v, ok := values[name]; ok {
+			parts = append(parts, name+"="+v)
+		}
+	}
+	return field + ": " + strings.Join(parts, ", ")
+}
+
+// ProvenanceReport 生成空投列表的来源说明，用于preview输出
+// 参数:
+//   - airdrops: 已生成消息的空投列表
+// 返回:
+//   - string: 每个空投一行，列出来源、非默认来源的字段和冲突；没有合并信息时返回空字符串
+func ProvenanceReport(airdrops []Airdrop) string {
+	var b strings.Builder
+	for _, item := range airdrops {
+		if len(item.Sources) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "- %s 阶段%d: 来源 %s", item.Token, item.Phase, strings.Join(item.Sources, "+"))
+
+		// 只列出不是来自首选来源的字段，避免每行都把所有字段打一遍
+		var fields []string
+		for _, field := range mergeFields {
+			if src, ok := item.Provenance[field.name]; ok && src != item.Sources[0] {
+				fields = append(fields, field.name+"←"+src)
+			}
+		}
+		if len(fields) > 0 {
+			fmt.Fprintf(&b, "；%s", strings.Join(fields, ", "))
+		}
+		for _, conflict := range item.Conflicts {
+			fmt.Fprintf(&b, "\n  冲突 %s", conflict)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
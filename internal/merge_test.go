@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSameAirdrop(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b Airdrop
+		want bool
+	}{
+		{"代币相同忽略大小写", Airdrop{Token: "abc", Phase: 1}, Airdrop{Token: "ABC", Phase: 1}, true},
+		{"阶段不同", Airdrop{Token: "ABC", Phase: 1}, Airdrop{Token: "ABC", Phase: 2}, false},
+		{"合约地址相同", Airdrop{Token: "ABC", ContractAddress: "0xAb", Phase: 1}, Airdrop{Token: "XYZ", ContractAddress: "0xab", Phase: 1}, true},
+		{"合约地址不同时不看代币", Airdrop{Token: "ABC", ContractAddress: "0x1", Phase: 1}, Airdrop{Token: "ABC", ContractAddress: "0x2", Phase: 1}, false},
+		{"一方缺少合约地址时比较代币", Airdrop{Token: "ABC", ContractAddress: "0x1", Phase: 1}, Airdrop{Token: "ABC", Phase: 1}, true},
+		{"都没有代币", Airdrop{Phase: 1}, Airdrop{Phase: 1}, false},
+	}
+	for _, c := range cases {
+		if got := sameAirdrop(&c.a, &c.b); got != c.want {
+			t.Errorf("%s: 期望%v，实际%v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestMergeAirdrops(t *testing.T) {
+	cases := []struct {
+		name           string
+		cfg            MergeConfig
+		results        []sourceResult
+		wantCount      int
+		wantTime       string
+		wantAmount     string
+		wantSources    []string
+		wantProvenance map[string]string
+		wantConflicts  []string
+	}{
+		{
+			name: "按默认优先级取值，空值由后面的来源补上",
+			results: []sourceResult{
+				{"api", []Airdrop{{Token: "ABC", Phase: 1, Date: "2025-09-10", Amount: "100"}}},
+				{"html", []Airdrop{{Token: "abc", Phase: 1, Date: "2025-09-10", Time: "18:00", Amount: "100"}}},
+			},
+			wantCount:      1,
+			wantTime:       "18:00",
+			wantAmount:     "100",
+			wantSources:    []string{"api", "html"},
+			wantProvenance: map[string]string{"date": "api", "time": "html", "amount": "api"},
+		},
+		{
+			name: "取值不同时记录冲突，千分位逗号不算冲突",
+			results: []sourceResult{
+				{"api", []Airdrop{{Token: "ABC", Phase: 1, Time: "18:00", Amount: "1,000"}}},
+				{"html", []Airdrop{{Token: "ABC", Phase: 1, Time: "19:00", Amount: "1000"}}},
+			},
+			wantCount:      1,
+			wantTime:       "18:00",
+			wantAmount:     "1,000",
+			wantSources:    []string{"api", "html"},
+			wantProvenance: map[string]string{"time": "api", "amount": "api"},
+			wantConflicts:  []string{"time: api=18:00, html=19:00"},
+		},
+		{
+			name: "按字段覆盖优先级",
+			cfg:  MergeConfig{FieldPriority: map[string][]string{"time": {"manual", "api"}}},
+			results: []sourceResult{
+				{"api", []Airdrop{{Token: "ABC", Phase: 1, Time: "18:00", Amount: "100"}}},
+				{"manual", []Airdrop{{Token: "ABC", Phase: 1, Time: "20:00", Amount: "200"}}},
+			},
+			wantCount:      1,
+			wantTime:       "20:00",
+			wantAmount:     "100",
+			wantSources:    []string{"api", "manual"},
+			wantProvenance: map[string]string{"time": "manual", "amount": "api"},
+			wantConflicts:  []string{"time: manual=20:00, api=18:00", "amount: api=100, manual=200"},
+		},
+		{
+			name: "同一来源的重复空投分别保留",
+			results: []sourceResult{
+				{"api", []Airdrop{{Token: "ABC", Phase: 1, Time: "18:00"}, {Token: "ABC", Phase: 1, Time: "19:00"}}},
+			},
+			wantCount:      2,
+			wantTime:       "18:00",
+			wantSources:    []string{"api"},
+			wantProvenance: map[string]string{"time": "api"},
+		},
+	}
+	for _, c := range cases {
+		merged := mergeAirdrops(context.Background(), c.results, c.cfg)
+		if len(merged) != c.wantCount {
+			t.Errorf("%s: 期望%d个空投，实际%d", c.name, c.wantCount, len(merged))
+			continue
+		}
+		item := merged[0]
+		if item.Time != c.wantTime || item.Amount != c.wantAmount {
+			t.Errorf("%s: 期望时间%q数量%q，实际%q %q", c.name, c.wantTime, c.wantAmount, item.Time, item.Amount)
+		}
+		if !reflect.DeepEqual(item.Sources, c.wantSources) {
+			t.Errorf("%s: 期望来源%v，实际%v", c.name, c.wantSources, item.Sources)
+		}
+		for field, want := range c.wantProvenance {
+			if got := item.Provenance[field]; got != want {
+				t.Errorf("%s: 字段%s期望来自%s，实际%s", c.name, field, want, got)
+			}
+		}
+		if !reflect.DeepEqual(item.Conflicts, c.wantConflicts) {
+			t.Errorf("%s: 期望冲突%v，实际%v", c.name, c.wantConflicts, item.Conflicts)
+		}
+	}
+}
+
+func TestOrderByPriority(t *testing.T) {
+	cases := []struct {
+		present, custom, want []string
+	}{
+		{[]string{"api", "html", "manual"}, []string{"manual"}, []string{"manual", "api", "html"}},
+		{[]string{"api", "html"}, []string{"html", "api"}, []string{"html", "api"}},
+		{[]string{"api", "html"}, []string{"manual"}, []string{"api", "html"}},
+	}
+	for _, c := range cases {
+		if got := orderByPriority(c.present, c.custom); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%v按%v排序: 期望%v，实际%v", c.present, c.custom, c.want, got)
+		}
+	}
+}
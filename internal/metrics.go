@@ -0,0 +1,174 @@
+// Package internal 包含项目的核心功能实现
+// 该文件定义Prometheus指标，并提供记录指标的函数和带指标统计的HTTP Transport
+package internal
+
+import (
+	"errors"   // 用于判断价格错误类型
+	"net/http" // 用于包装RoundTripper
+	"strconv"  // 用于状态码转换
+	"time"     // 用于统计耗时
+
+	"github.com/prometheus/client_golang/prometheus"            // 指标定义
+	"github.com/prometheus/client_golang/prometheus/collectors" // Go运行时和进程指标
+	"github.com/prometheus/client_golang/prometheus/promhttp"   // 指标输出
+)
+
+// metricsNamespace 指标名前缀
+const metricsNamespace = "alpha_wx_notify"
+
+// 检查周期的结果，用于cycles_total的result标签
+const (
+	CycleOK          = "ok"          // 正常完成
+	CycleUnavailable = "unavailable" // 上游和缓存都不可用
+	CycleStale       = "stale"       // 只有过期缓存，跳过推送
+	CycleAborted     = "aborted"     // 超时或程序退出
+)
+
+// 价格查询的结果，用于price_lookups_total的result标签
+const (
+	PriceHit     = "hit"     // 查到价格
+	PriceMiss    = "miss"    // 接口明确表示没有价格
+	PriceFailure = "failure" // 请求失败或熔断
+)
+
+// 推送渠道，用于notifications_total的channel标签
+const (
+	ChannelServerChan = "serverchan" // 普通订阅者
+	ChannelAlert      = "alert"      // 运维告警
+)
+
+// metricsRegistry 本程序使用的指标注册表，不使用全局默认注册表，避免依赖包注册的指标混入
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	cyclesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cycles_total",
+		Help:      "检查周期次数，按结果区分",
+	}, []string{"result"})
+
+	fetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "fetch_duration_seconds",
+		Help:      "上游请求耗时，按接口和状态码区分，请求失败时status为error",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"endpoint", "status"})
+
+	upstreamForbidden = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "upstream_403_total",
+		Help:      "上游返回403的次数，通常表示Cookie失效或被反爬虫拦截",
+	}, []string{"endpoint"})
+
+	priceLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "price_lookups_total",
+		Help:      "价格查询次数，按hit、miss、failure区分",
+	}, []string{"result"})
+
+	airdropsInWindow = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "airdrops_in_window",
+		Help:      "最近一次检查中位于展示窗口（今天起3天内）的空投数量",
+	})
+
+	changesDetected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "changes_total",
+		Help:      "检测到的空投变化，按类型区分",
+	}, []string{"kind"})
+
+	notifications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "notifications_total",
+		Help:      "推送次数，按渠道、接收人和结果区分",
+	}, []string{"channel", "recipient", "result"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		cyclesTotal, fetchDuration, upstreamForbidden, priceLookups,
+		airdropsInWindow, changesDetected, notifications,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// MetricsHandler 返回输出Prometheus指标的HTTP处理器
+// 返回:
+//   - http.Handler: /metrics处理器
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// RecordCycle 记录一次检查周期的结果，同时更新健康检查中的周期完成时间
+// 参数:
+//   - result: CycleOK、CycleUnavailable、CycleStale或CycleAborted
+func RecordCycle(result string) {
+	cyclesTotal.WithLabelValues(result).Inc()
+	health.recordCycle()
+}
+
+// RecordChanges 记录检测到的空投变化
+// 参数:
+//   - counts: 变化类型到数量的映射
+func RecordChanges(counts map[string]int) {
+	for kind, n := range counts {
+		changesDetected.WithLabelValues(kind).Add(float64(n))
+	}
+}
+
+// recordNotification 记录一次推送的结果
+func recordNotification(channel, sendkey string, err error) {
+	result := "sent"
+	if err != nil {
+		result = "failed"
+	}
+	notifications.WithLabelValues(channel, recipientLabel(sendkey), result).Inc()
+}
+
+// recordPriceLookup 按FetchTokenPrice的返回值记录价格查询结果
+func recordPriceLookup(err error) {
+	switch {
+	case err == nil:
+		priceLookups.WithLabelValues(PriceHit).Inc()
+	case errors.Is(err, errPriceUnavailable):
+		priceLookups.WithLabelValues(PriceMiss).Inc()
+	default:
+		priceLookups.WithLabelValues(PriceFailure).Inc()
+	}
+}
+
+// metricsTransport 统计每次上游请求耗时和状态码的RoundTripper
+type metricsTransport struct {
+	base     http.RoundTripper
+	endpoint string
+}
+
+// instrumentTransport 为Transport加上指标统计
+// 参数:
+//   - base: 实际发送请求的Transport，为nil时使用http.DefaultTransport
+//   - endpoint: 接口名，如EndpointData、EndpointPrice、EndpointHTML
+// 返回:
+//   - http.RoundTripper: 带指标统计的Transport
+func instrumentTransport(base http.RoundTripper, endpoint string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &metricsTransport{base: base, endpoint: endpoint}
+}
+
+// RoundTrip 发送请求并记录耗时、状态码和403次数
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+		if resp.StatusCode == http.StatusForbidden {
+			upstreamForbidden.WithLabelValues(t.endpoint).Inc()
+		}
+	}
+	fetchDuration.WithLabelValues(t.endpoint, status).Observe(time.Since(start).Seconds())
+	return resp, err
+}
@@ -0,0 +1,228 @@
+// Package internal 包含项目的核心功能实现
+// 该文件实现本地覆盖文件：修正上游的错误字段、隐藏项目、手工添加项目或暂停提醒
+package internal
+
+import (
+	"context"       // 用于日志中的cycle_id
+	"encoding/json" // 用于解析覆盖文件
+	"fmt"           // 用于格式化输出
+	"log/slog"      // 用于结构化日志
+	"os"            // 用于文件操作
+	"strings"       // 用于字符串处理
+	"time"          // 用于过期时间判断
+)
+
+// defaultOverridesFile 覆盖文件的默认文件名，位于状态目录下
+const defaultOverridesFile = "overrides.json"
+
+// SourceOverride 覆盖文件在Sources和Provenance中的名称
+const SourceOverride = "override"
+
+// 覆盖动作
+const (
+	OverridePatch  = "patch"  // 修改匹配项目的字段（默认）
+	OverrideHide   = "hide"   // 隐藏匹配的项目
+	OverrideAdd    = "add"    // 没有匹配项目时新增，有则按patch处理
+	OverrideSnooze = "snooze" // 保留匹配的项目，但不发送开始前提醒
+)
+
+// OverrideFields 需要覆盖的字段，未填写的字段保持上游的值
+type OverrideFields struct {
+	Name   *string     `json:"name"`
+	Date   *string     `json:"date"`
+	Time   *string     `json:"time"`
+	Points interface{} `json:"points"`
+	Amount *string     `json:"amount"`
+	Type   *string     `json:"type"`
+}
+
+// Override 单条覆盖规则
+// 填写contract_address时按合约地址匹配，否则按代币符号匹配；phase不填时匹配所有阶段
+type Override struct {
+	Token           string         `json:"token"`            // 代币符号
+	Phase           *int           `json:"phase"`            // 空投阶段，可选
+	ContractAddress string         `json:"contract_address"` // 合约地址，可选
+	Action          string         `json:"action"`           // patch、hide、add或snooze
+	Set             OverrideFields `json:"set"`              // 覆盖的字段
+	Expires         string         `json:"expires"`          // 过期时间，"2006-01-02"或"2006-01-02 15:04"，按timezone解释，为空表示不过期
+	Note            string         `json:"note"`             // 备注，说明为什么需要这条覆盖
+}
+
+// OverridesFile 覆盖文件的结构
+type OverridesFile struct {
+	Overrides []Override `json:"overrides"`
+}
+
+// LoadOverrides 读取覆盖文件
+// 参数:
+//   - path: 覆盖文件路径
+// 返回:
+//   - []Override: 覆盖规则，文件不存在时为空
+//   - error: 读取或解析失败时返回错误
+func LoadOverrides(path string) ([]Override, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var file OverridesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析覆盖文件失败: %v", err)
+	}
+	return file.Overrides, nil
+}
+
+// expired 判断覆盖规则是否已过期
+// 过期时间按配置的时区解释，与空投的日期时间一致；只写日期时在当天结束后过期
+func (o *Override) expired(now time.Time, loc *time.Location) bool {
+	if o.Expires == "" {
+		return false
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", o.Expires, loc); err == nil {
+		return now.After(t)
+	}
+	if t, err := time.ParseInLocation("2006-01-02", o.Expires, loc); err == nil {
+		return now.After(t.AddDate(0, 0, 1))
+	}
+	slog.Warn("覆盖规则的过期时间格式错误，视为已过期", "rule", o.describe(), "expires", o.Expires)
+	return true
+}
+
+// matches 判断覆盖规则是否作用于该空投
+func (o *Override) matches(item *Airdrop) bool {
+	if o.Phase != nil && *o.Phase != item.Phase {
+		return false
+	}
+	if o.ContractAddress != "" {
+		return strings.EqualFold(o.ContractAddress, item.ContractAddress)
+	}
+	return o.Token != "" && strings.EqualFold(o.Token, item.Token)
+}
+
+// describe 返回便于日志阅读的规则描述
+func (o *Override) describe() string {
+	key := o.Token
+	if o.ContractAddress != "" {
+		key = o.ContractAddress
+	}
+	if o.Phase != nil {
+		key += fmt.Sprintf(" 阶段%d", *o.Phase)
+	}
+	return key
+}
+
+// patch 把覆盖字段写入空投，并记录字段来源
+func (o *Override) patch(item *Airdrop) {
+	set := func(field string, apply func()) {
+		apply()
+		if item.Provenance == nil {
+			item.Provenance = make(map[string]string)
+		}
+		item.Provenance[field] = SourceOverride
+	}
+	if o.Set.Name != nil {
+		set("name", func() { item.Name = *o.Set.Name })
+	}
+	if o.Set.Date != nil {
+		set("date", func() { item.Date = *o.Set.Date })
+	}
+	if o.Set.Time != nil {
+		set("time", func() { item.Time = *o.Set.Time })
+	}
+	if o.Set.Points != nil {
+		set("points", func() { item.Points = o.Set.Points })
+	}
+	if o.Set.Amount != nil {
+		set("amount", func() { item.Amount = *o.Set.Amount })
+	}
+	if o.Set.Type != nil {
+		set("type", func() { item.Type = *o.Set.Type })
+	}
+}
+
+// applyOverrides 把覆盖文件应用到获取到的空投列表上
+// 在获取数据之后、按日期和类型过滤之前调用，过期的规则自动忽略
+// 回放时默认不应用，capture.overrides为true（replay -overrides）时才应用
+// 参数:
+//   - ctx: 上下文，用于日志中的cycle_id
+//   - airdrops: 获取到的空投列表
+//   - source: 数据来源名称，用于在Sources中标明被覆盖项目的原始来源
+// 返回:
+//   - []Airdrop: 应用覆盖后的新列表
+func (s *AirdropService) applyOverrides(ctx context.Context, airdrops []Airdrop, source string) []Airdrop {
+	if s.replaying() && !s.config.Capture.Overrides {
+		return airdrops
+	}
+	logger := Logger(ctx)
+	path := s.config.OverridesFile
+	if path == "" {
+		path = s.config.StatePath(defaultOverridesFile)
+	}
+	overrides, err := LoadOverrides(path)
+	if err != nil {
+		logger.Error("读取覆盖文件失败，本次不应用覆盖", LogKeyPath, path, LogKeyError, err)
+		return airdrops
+	}
+	if len(overrides) == 0 {
+		return airdrops
+	}
+
+	now := s.now()
+	result := append([]Airdrop(nil), airdrops...)
+	markOverridden := func(item *Airdrop) {
+		if len(item.Sources) == 0 && source != "" {
+			item.Sources = []string{source}
+		}
+		if n := len(item.Sources); n == 0 || item.Sources[n-1] != SourceOverride {
+			item.Sources = append(item.Sources, SourceOverride) // 多条规则命中同一项目时只记一次
+		}
+	}
+
+	for i := range overrides {
+		o := &overrides[i]
+		if o.expired(now, s.config.Location()) {
+			continue
+		}
+		action := o.Action
+		if action == "" {
+			action = OverridePatch
+		}
+
+		matched := false
+		kept := result[:0]
+		for _, item := range result {
+			if !o.matches(&item) {
+				kept = append(kept, item)
+				continue
+			}
+			matched = true
+			if action == OverrideHide {
+				logger.Info("覆盖规则隐藏了空投", LogKeyToken, item.Token, "phase", item.Phase)
+				continue
+			}
+			if action == OverrideSnooze {
+				item.Snoozed = true
+				kept = append(kept, item)
+				continue
+			}
+			o.patch(&item)
+			markOverridden(&item)
+			kept = append(kept, item)
+		}
+		result = kept
+
+		if action == OverrideAdd && !matched {
+			item := Airdrop{Token: o.Token, ContractAddress: o.ContractAddress, Type: "airdrop"}
+			if o.Phase != nil {
+				item.Phase = *o.Phase
+			}
+			o.patch(&item)
+			item.Sources = []string{SourceOverride}
+			result = append(result, item)
+			logger.Info("覆盖规则新增了空投", "rule", o.describe())
+		}
+	}
+	return result
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOverrideExpired(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	// 北京时间2025-09-10 23:30，UTC时间2025-09-10 15:30
+	now := time.Date(2025, 9, 10, 15, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		name    string
+		expires string
+		loc     *time.Location
+		want    bool
+	}{
+		{"没有过期时间", "", shanghai, false},
+		{"当天只写日期，当天结束前有效", "2025-09-10", shanghai, false},
+		{"前一天只写日期", "2025-09-09", shanghai, true},
+		{"日期时间已过", "2025-09-10 23:00", shanghai, true},
+		{"日期时间未到", "2025-09-10 23:45", shanghai, false},
+		// 同一个过期时间按UTC解释时还没到，按北京时间解释时已过
+		{"按UTC解释", "2025-09-10 16:00", time.UTC, false},
+		{"按北京时间解释", "2025-09-10 16:00", shanghai, true},
+		{"格式错误视为已过期", "2025/09/10", shanghai, true},
+	}
+	for _, c := range cases {
+		o := Override{Token: "ABC", Expires: c.expires}
+		if got := o.expired(now, c.loc); got != c.want {
+			t.Errorf("%s: 期望%v，实际%v", c.name, c.want, got)
+		}
+	}
+
+	// 北京时间9月11日0:30时，9月10日的规则已过期，而按UTC解释仍在9月10日当天
+	late := time.Date(2025, 9, 10, 16, 30, 0, 0, time.UTC)
+	o := Override{Token: "ABC", Expires: "2025-09-10"}
+	if !o.expired(late, shanghai) {
+		t.Error("北京时间已过当天，规则应过期")
+	}
+	if o.expired(late, time.UTC) {
+		t.Error("UTC时间仍在当天，规则不应过期")
+	}
+}
+
+func TestOverrideMatches(t *testing.T) {
+	phase := 2
+	cases := []struct {
+		name string
+		rule Override
+		item Airdrop
+		want bool
+	}{
+		{"代币忽略大小写", Override{Token: "abc"}, Airdrop{Token: "ABC", Phase: 1}, true},
+		{"不限阶段", Override{Token: "ABC"}, Airdrop{Token: "ABC", Phase: 3}, true},
+		{"阶段不同", Override{Token: "ABC", Phase: &phase}, Airdrop{Token: "ABC", Phase: 1}, false},
+		{"合约地址优先于代币", Override{Token: "ABC", ContractAddress: "0x1"}, Airdrop{Token: "ABC", ContractAddress: "0x2"}, false},
+		{"合约地址相同", Override{ContractAddress: "0xAB"}, Airdrop{Token: "XYZ", ContractAddress: "0xab"}, true},
+		{"没有代币和合约地址", Override{}, Airdrop{Token: "ABC"}, false},
+	}
+	for _, c := range cases {
+		if got := c.rule.matches(&c.item); got != c.want {
+			t.Errorf("%s: 期望%v，实际%v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestApplyOverridesReplay(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/overrides.json"
+	if err := os.WriteFile(path, []byte(`{"overrides": [{"token": "ABC", "action": "hide"}]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name    string
+		capture CaptureConfig
+		want    int // 应用覆盖后的空投数量
+	}{
+		{"非回放时应用", CaptureConfig{}, 0},
+		{"回放时默认不应用", CaptureConfig{Mode: CaptureReplay}, 1},
+		{"回放时指定-overrides", CaptureConfig{Mode: CaptureReplay, Overrides: true}, 0},
+	}
+	for _, c := range cases {
+		s := &AirdropService{config: &Config{StateDir: dir, OverridesFile: path, Capture: c.capture}}
+		got := s.applyOverrides(context.Background(), []Airdrop{{Token: "ABC", Phase: 1}}, SourceAPI)
+		if len(got) != c.want {
+			t.Errorf("%s: 期望%d个空投，实际%d个", c.name, c.want, len(got))
+		}
+	}
+}
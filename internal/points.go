@@ -0,0 +1,258 @@
+// Package internal 包含项目的核心功能实现
+// 该文件记录每个空投所需积分随时间的变化，发现积分门槛下降时，
+// 通知当前积分刚好达到新门槛的接收人
+package internal
+
+import (
+	"context"       // 用于日志和取消推送
+	"encoding/json" // 用于积分记录的编解码
+	"fmt"           // 用于格式化
+	"log/slog"      // 用于迁移旧文件时的提示
+	"os"            // 用于读写积分记录
+	"sort"          // 用于按代币排列提醒
+	"strconv"       // 用于解析积分
+	"strings"       // 用于字符串处理
+	"time"          // 用于时间处理
+)
+
+// pointsHistoryFile 积分记录文件名，位于状态目录下
+const pointsHistoryFile = "points_history.json"
+
+// legacyPointsFile 旧版只保存上次积分的文件名，第一次读取积分记录时迁移
+const legacyPointsFile = "points.json"
+
+// pointsHistoryRetention 空投最后一次出现后积分记录保留的时间
+const pointsHistoryRetention = 30 * 24 * time.Hour
+
+// PointsSample 某个时刻观察到的所需积分
+type PointsSample struct {
+	At     time.Time `json:"at"`     // 观察到该值的时间
+	Points string    `json:"points"` // 所需积分，保持上游的原始写法
+}
+
+// PointsHistory 积分记录，键为"代币|阶段"，每个空投只在积分变化时追加
+type PointsHistory map[string][]PointsSample
+
+// pointsKey 积分记录的键
+func pointsKey(token string, phase int) string {
+	return fmt.Sprintf("%s|%d", token, phase)
+}
+
+// parsePoints 解析积分中的数字部分，如"200"、"200分"，无法解析时返回false
+func parsePoints(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, err := strconv.Atoi(s[:end])
+	return n, err == nil
+}
+
+// LoadPointsHistory 读取积分记录
+// 参数:
+//   - cfg: 配置信息，用于定位状态目录
+// 返回:
+//   - PointsHistory: 积分记录，文件不存在时为空
+//   - error: 读取或解析失败时返回错误
+func LoadPointsHistory(cfg *Config) (PointsHistory, error) {
+	history := make(PointsHistory)
+	data, err := os.ReadFile(cfg.StatePath(pointsHistoryFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return migrateLegacyPoints(cfg)
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &history); err != nil {
+		return nil, fmt.Errorf("解析积分记录失败: %v", err)
+	}
+	return history, nil
+}
+
+// migrateLegacyPoints 把旧版points.json（键为"代币|阶段"，值为上次的积分）转换为积分记录
+// 每个空投得到一条以文件修改时间为时间的记录，写入points_history.json后删除旧文件
+// 参数:
+//   - cfg: 配置信息，用于定位状态目录
+// 返回:
+//   - PointsHistory: 转换后的积分记录，没有旧文件时为空
+//   - error: 读取、解析或写入失败时返回错误
+func migrateLegacyPoints(cfg *Config) (PointsHistory, error) {
+	history := make(PointsHistory)
+	legacy := cfg.StatePath(legacyPointsFile)
+	info, err := os.Stat(legacy)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return history, nil
+		}
+		return nil, err
+	}
+	data, err := os.ReadFile(legacy)
+	if err != nil {
+		return nil, err
+	}
+	var last map[string]string
+	if err := json.Unmarshal(data, &last); err != nil {
+		return nil, fmt.Errorf("解析旧的积分文件失败: %v", err)
+	}
+	for key, points := range last {
+		history[key] = []PointsSample{{At: info.ModTime(), Points: points}}
+	}
+	data, _ = json.Marshal(history)
+	if err := os.WriteFile(cfg.StatePath(pointsHistoryFile), data, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(legacy); err != nil {
+		return nil, err
+	}
+	slog.Info("已把旧的积分文件迁移为积分记录", LogKeyPath, legacy, LogKeyCount, len(history))
+	return history, nil
+}
+
+// pointsDrop 一次积分门槛下降
+type pointsDrop struct {
+	airdrop PricedAirdrop
+	from    int
+	to      int
+}
+
+// RecordPointsChanges 记录最近一次检查中各空投的所需积分，变化时记录事件，下降时通知达到新门槛的接收人
+// 积分不在快照中，因此每个使用实时数据的周期都要调用；第一次见到某个空投只记录积分，不产生事件
+// 参数:
+//   - ctx: 上下文，用于日志和取消推送
+func (s *AirdropService) RecordPointsChanges(ctx context.Context) {
+	view := s.View()
+	if !view.Status.Available || view.Status.Stale || s.replaying() {
+		return
+	}
+	logger := Logger(ctx)
+	history, err := LoadPointsHistory(s.config)
+	if err != nil {
+		logger.Error("读取积分记录失败，本次不比较积分", LogKeyError, err)
+		return
+	}
+
+	now := s.now()
+	events, drops := comparePoints(history, view.Airdrops, now)
+	for _, d := range drops {
+		logger.Info("积分门槛下降", LogKeyToken, d.airdrop.Token, "phase", d.airdrop.Phase, "from", d.from, "to", d.to)
+	}
+
+	// 长期不再出现的空投不再保留
+	for key, samples := range history {
+		if n := len(samples); n > 0 && now.Sub(samples[n-1].At) > pointsHistoryRetention {
+			delete(history, key)
+		}
+	}
+	data, _ := json.Marshal(history)
+	if err := os.WriteFile(s.config.StatePath(pointsHistoryFile), data, 0644); err != nil {
+		logger.Error("保存积分记录失败", LogKeyError, err)
+	}
+
+	if len(events) > 0 {
+		RecordChanges(map[string]int{ChangePoints: len(events)})
+		s.saveChangeEvents(ctx, events)
+	}
+	if len(drops) > 0 {
+		s.sendEligibilityAlerts(ctx, drops)
+	}
+}
+
+// comparePoints 把本次的所需积分追加到积分记录，返回积分变化事件和门槛下降
+// 第一次见到某个空投只记录积分，不产生事件；积分无法解析为数字时只产生事件
+// 参数:
+//   - history: 积分记录，积分变化的空投会追加一条记录
+//   - airdrops: 本次检查的空投
+//   - now: 检查时间
+// 返回:
+//   - []ChangeEvent: 积分变化事件
+//   - []pointsDrop: 积分门槛下降
+func comparePoints(history PointsHistory, airdrops []PricedAirdrop, now time.Time) ([]ChangeEvent, []pointsDrop) {
+	var events []ChangeEvent
+	var drops []pointsDrop
+	for _, a := range airdrops {
+		points := pointsString(a.Points)
+		if points == "" {
+			continue
+		}
+		key := pointsKey(a.Token, a.Phase)
+		samples := history[key]
+		if n := len(samples); n > 0 && samples[n-1].Points == points {
+			continue
+		}
+		history[key] = append(samples, PointsSample{At: now, Points: points})
+		if len(samples) == 0 {
+			continue
+		}
+
+		old := samples[len(samples)-1].Points
+		e := ChangeEvent{
+			DetectedAt: now,
+			Kind:       ChangePoints,
+			Token:      a.Token,
+			Name:       a.Name,
+			Phase:      a.Phase,
+			Date:       a.Date,
+			Time:       a.Time,
+			Amount:     a.Amount,
+			Points:     points,
+			OldPoints:  old,
+		}
+		e.ID = eventID(e)
+		events = append(events, e)
+
+		from, ok1 := parsePoints(old)
+		to, ok2 := parsePoints(points)
+		if ok1 && ok2 && to < from {
+			drops = append(drops, pointsDrop{airdrop: a, from: from, to: to})
+		}
+	}
+	return events, drops
+}
+
+// eligibleDrops 返回门槛从高于balance降到不高于balance的下降，即接收人刚好达到新门槛的空投
+func eligibleDrops(drops []pointsDrop, balance int) []pointsDrop {
+	var eligible []pointsDrop
+	for _, d := range drops {
+		if d.from > balance && d.to <= balance {
+			eligible = append(eligible, d)
+		}
+	}
+	return eligible
+}
+
+// sendEligibilityAlerts 向积分刚好达到新门槛的接收人发送提醒
+// 只有门槛从高于接收人积分降到不高于接收人积分时才通知，之前已经达到的不再重复；没有配置积分的接收人跳过
+func (s *AirdropService) sendEligibilityAlerts(ctx context.Context, drops []pointsDrop) {
+	sort.Slice(drops, func(i, j int) bool { return drops[i].airdrop.Token < drops[j].airdrop.Token })
+	for _, r := range s.config.SendKeys {
+		balance, ok, err := r.Balance(s.config, s.now())
+		if err != nil {
+			Logger(ctx).Warn("读取接收人积分失败，跳过积分门槛提醒", LogKeyRecipient, recipientLabel(r.SendKey), LogKeyError, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		eligible := eligibleDrops(drops, balance)
+		if len(eligible) == 0 {
+			continue
+		}
+
+		title := fmt.Sprintf("积分门槛降到%d，可以领取%s", eligible[0].to, eligible[0].airdrop.Token)
+		if len(eligible) > 1 {
+			title = fmt.Sprintf("%d个空投的积分门槛降到你的积分以下", len(eligible))
+		}
+		msg := fmt.Sprintf("你的积分：%d\n\n| 项目 | 时间 | 原门槛 | 新门槛 | 数量 |\n|---|---|---|---|---|\n", balance)
+		for _, d := range eligible {
+			a := d.airdrop
+			msg += fmt.Sprintf("| %s(%s) | %s %s | %d | %d | %s |\n", a.Token, a.Name, a.Date, a.Time, d.from, d.to, a.Amount)
+		}
+
+		Logger(ctx).Info("发送积分门槛提醒", LogKeyRecipient, recipientLabel(r.SendKey), LogKeyCount, len(eligible))
+		if err := sendToKeys(ctx, msg, title, s.config, []string{r.SendKey}); err != nil {
+			Logger(ctx).Error("积分门槛提醒中止", LogKeyError, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+// pointsAirdrop 生成所需积分为points的空投
+func pointsAirdrop(token string, points interface{}) PricedAirdrop {
+	return PricedAirdrop{Airdrop: Airdrop{Token: token, Phase: 1, Date: "2025-09-10", Points: points}}
+}
+
+func TestParsePoints(t *testing.T) {
+	cases := []struct {
+		in     string
+		want   int
+		wantOK bool
+	}{
+		{"200", 200, true},
+		{" 180 ", 180, true},
+		{"220分", 220, true},
+		{"", 0, false},
+		{"待公布", 0, false},
+	}
+	for _, c := range cases {
+		got, ok := parsePoints(c.in)
+		if got != c.want || ok != c.wantOK {
+			t.Errorf("%q: 期望(%d, %v)，实际(%d, %v)", c.in, c.want, c.wantOK, got, ok)
+		}
+	}
+}
+
+func TestComparePoints(t *testing.T) {
+	earlier := time.Date(2025, 9, 9, 12, 0, 0, 0, time.UTC)
+	now := earlier.Add(time.Hour)
+	cases := []struct {
+		name       string
+		history    []string // 已记录的积分，为空表示第一次见到
+		points     interface{}
+		wantEvent  bool
+		wantDrop   bool
+		wantLength int // 之后的记录条数
+	}{
+		{"第一次见到只记录", nil, "200", false, false, 1},
+		{"没有积分不记录", nil, nil, false, false, 0},
+		{"积分不变", []string{"200"}, "200", false, false, 1},
+		{"数字与字符串写法相同", []string{"200"}, 200.0, false, false, 1},
+		{"积分上升只记录事件", []string{"200"}, "220", true, false, 2},
+		{"积分下降", []string{"200"}, "180", true, true, 2},
+		{"与最近一次比较", []string{"150", "200"}, "180", true, true, 3},
+		{"无法解析的积分只记录事件", []string{"200"}, "待公布", true, false, 2},
+	}
+	for _, c := range cases {
+		history := make(PointsHistory)
+		key := pointsKey("ABC", 1)
+		for _, p := range c.history {
+			history[key] = append(history[key], PointsSample{At: earlier, Points: p})
+		}
+		events, drops := comparePoints(history, []PricedAirdrop{pointsAirdrop("ABC", c.points)}, now)
+		if (len(events) == 1) != c.wantEvent || (len(drops) == 1) != c.wantDrop {
+			t.Errorf("%s: 期望事件%v下降%v，实际%d个事件%d个下降", c.name, c.wantEvent, c.wantDrop, len(events), len(drops))
+		}
+		if got := len(history[key]); got != c.wantLength {
+			t.Errorf("%s: 期望%d条记录，实际%d条", c.name, c.wantLength, got)
+		}
+		if c.wantDrop && (drops[0].from != 200 || drops[0].to != 180) {
+			t.Errorf("%s: 期望从200降到180，实际%+v", c.name, drops[0])
+		}
+	}
+}
+
+func TestEligibleDrops(t *testing.T) {
+	drops := []pointsDrop{
+		{airdrop: pointsAirdrop("A", "180"), from: 200, to: 180},
+		{airdrop: pointsAirdrop("B", "150"), from: 190, to: 150},
+	}
+	cases := []struct {
+		name    string
+		balance int
+		want    []string
+	}{
+		{"刚好达到新门槛", 150, []string{"B"}},
+		{"同时跨过两个门槛", 185, []string{"A", "B"}},
+		{"等于旧门槛时之前已经达到", 190, []string{"A"}},
+		{"之前已经达到不再提醒", 200, nil},
+		{"降价后仍未达到", 140, nil},
+	}
+	for _, c := range cases {
+		var got []string
+		for _, d := range eligibleDrops(drops, c.balance) {
+			got = append(got, d.airdrop.Token)
+		}
+		if len(got) != len(c.want) || (len(got) > 0 && got[0] != c.want[0]) || (len(got) > 1 && got[1] != c.want[1]) {
+			t.Errorf("%s: 积分%d期望%v，实际%v", c.name, c.balance, c.want, got)
+		}
+	}
+}
+
+func TestRecordPointsChanges(t *testing.T) {
+	points := 100 // 不会达到任何门槛，不会真的推送
+	cfg := &Config{StateDir: t.TempDir(), SendKeys: []Recipient{{SendKey: "SCTtestkey123", Points: &points}}}
+	s := &AirdropService{config: cfg, replayClock: time.Date(2025, 9, 9, 12, 0, 0, 0, time.UTC)}
+	ctx := context.Background()
+	run := func(pts string) {
+		s.view = AirdropView{Status: DataStatus{Available: true}, Airdrops: []PricedAirdrop{pointsAirdrop("ABC", pts)}}
+		s.RecordPointsChanges(ctx)
+		s.replayClock = s.replayClock.Add(time.Hour)
+	}
+
+	run("200")
+	if events, _ := LoadChangeEvents(cfg, 0); len(events) != 0 {
+		t.Errorf("第一次见到不应产生事件，实际%d个", len(events))
+	}
+	run("180")
+	events, _ := LoadChangeEvents(cfg, 0)
+	if len(events) != 1 || events[0].OldPoints != "200" || events[0].Points != "180" {
+		t.Errorf("积分下降应产生一个事件，实际%+v", events)
+	}
+	history, err := LoadPointsHistory(cfg)
+	if err != nil || len(history[pointsKey("ABC", 1)]) != 2 {
+		t.Errorf("应保存两条积分记录，实际%v %v", history, err)
+	}
+
+	// 过期数据不记录
+	s.view = AirdropView{Status: DataStatus{Available: true, Stale: true}, Airdrops: []PricedAirdrop{pointsAirdrop("ABC", "150")}}
+	s.RecordPointsChanges(ctx)
+	if history, _ := LoadPointsHistory(cfg); len(history[pointsKey("ABC", 1)]) != 2 {
+		t.Error("过期数据不应写入积分记录")
+	}
+}
+
+func TestMigrateLegacyPoints(t *testing.T) {
+	cfg := &Config{StateDir: t.TempDir()}
+	legacy := cfg.StatePath(legacyPointsFile)
+	data, _ := json.Marshal(map[string]string{"ABC|1": "200", "XYZ|2": "150"})
+	if err := os.WriteFile(legacy, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Date(2025, 9, 1, 8, 0, 0, 0, time.UTC)
+	os.Chtimes(legacy, modTime, modTime)
+
+	history, err := LoadPointsHistory(cfg)
+	if err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+	samples := history["ABC|1"]
+	if len(history) != 2 || len(samples) != 1 || samples[0].Points != "200" || !samples[0].At.Equal(modTime) {
+		t.Errorf("迁移结果错误: %+v", history)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Error("迁移后应删除旧文件")
+	}
+	if _, err := os.Stat(cfg.StatePath(pointsHistoryFile)); err != nil {
+		t.Errorf("迁移后应写入积分记录: %v", err)
+	}
+
+	// 迁移后的第一次检查与旧值比较，积分下降时产生事件
+	events, drops := comparePoints(history, []PricedAirdrop{pointsAirdrop("ABC", "180")}, modTime.Add(time.Hour))
+	if len(events) != 1 || len(drops) != 1 {
+		t.Errorf("迁移后应继续与旧值比较，实际%d个事件%d个下降", len(events), len(drops))
+	}
+
+	// 没有旧文件时为空
+	if history, err := LoadPointsHistory(&Config{StateDir: t.TempDir()}); err != nil || len(history) != 0 {
+		t.Errorf("没有任何文件时应返回空记录，实际%v %v", history, err)
+	}
+}
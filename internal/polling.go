@@ -0,0 +1,155 @@
+// Package internal 包含项目的核心功能实现
+// 该文件实现daemon的自适应检查间隔：空投开始前后加快检查，附近没有空投或处于夜间时放慢，
+// 开始时间与sortSnapshotItems排序所用的时间一致（parseDateTime，按配置的时区解释）
+package internal
+
+import (
+	"fmt"     // 用于格式化原因
+	"strings" // 用于解析夜间时段
+	"time"    // 用于时间计算
+)
+
+// 自适应间隔的默认值
+const (
+	defaultFastInterval = 1 * time.Minute  // 窗口内的检查间隔
+	defaultWindowBefore = 60 * time.Minute // 开始前多久进入窗口
+	defaultWindowAfter  = 15 * time.Minute // 开始后多久离开窗口
+	defaultIdleInterval = 15 * time.Minute // 空闲时的检查间隔
+	defaultIdleHorizon  = 6 * time.Hour    // 这段时间内没有空投开始时视为空闲
+	minPollInterval     = 30 * time.Second // 任何情况下两次检查的最短间隔
+)
+
+// 选择检查间隔的原因，用于日志
+const (
+	PollFixed  = "fixed"  // 未开启自适应
+	PollFast   = "fast"   // 位于某个空投的开始窗口内
+	PollWake   = "wake"   // 提前醒来以赶上开始窗口或提醒
+	PollNormal = "normal" // 附近有空投但还没到窗口
+	PollIdle   = "idle"   // 附近没有空投
+	PollQuiet  = "quiet"  // 夜间时段
+)
+
+// PollingConfig 自适应检查间隔配置，时间单位均为分钟
+type PollingConfig struct {
+	Adaptive     bool   `json:"adaptive"`     // 是否开启，关闭时固定使用interval
+	FastInterval int    `json:"fastInterval"` // 开始窗口内的检查间隔，默认1
+	WindowBefore int    `json:"windowBefore"` // 开始前多少分钟进入窗口，默认60
+	WindowAfter  int    `json:"windowAfter"`  // 开始后多少分钟离开窗口，默认15
+	IdleInterval int    `json:"idleInterval"` // 附近没有空投或夜间的检查间隔，默认15
+	IdleHorizon  int    `json:"idleHorizon"`  // 多少分钟内没有空投开始时视为空闲，默认360
+	QuietHours   string `json:"quietHours"`   // 夜间时段，如"01:00-08:00"，按timezone解释，可跨零点；为空表示不区分
+}
+
+// minutesOr 把分钟数转换为时长，未配置时使用默认值
+func minutesOr(minutes int, def time.Duration) time.Duration {
+	if minutes <= 0 {
+		return def
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// inQuietHours 判断t是否处于"HH:MM-HH:MM"描述的时段内，格式错误时返回false
+func inQuietHours(spec string, t time.Time) bool {
+	from, to, ok := strings.Cut(spec, "-")
+	if !ok {
+		return false
+	}
+	start, err1 := time.Parse("15:04", strings.TrimSpace(from))
+	end, err2 := time.Parse("15:04", strings.TrimSpace(to))
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	s := start.Hour()*60 + start.Minute()
+	e := end.Hour()*60 + end.Minute()
+	if s <= e {
+		return minute >= s && minute < e
+	}
+	return minute >= s || minute < e // 跨零点
+}
+
+// NextInterval 根据最近一次检查中的空投开始时间决定下次检查前等待多久
+// 位于某个空投开始前windowBefore到开始后windowAfter之间时使用fastInterval；
+// 下一个开始窗口或开始前提醒早于正常间隔时提前醒来；
+// idleHorizon内没有空投开始或处于夜间时段时使用idleInterval；上次检查没有拿到数据时使用interval
+// 返回:
+//   - time.Duration: 等待时长，不小于30秒
+//   - string: 选择的原因，PollFast、PollIdle等
+func (s *AirdropService) NextInterval() (time.Duration, string) {
+	base := s.config.CheckInterval()
+	p := s.config.Polling
+	if !p.Adaptive {
+		return base, PollFixed
+	}
+	fast := minutesOr(p.FastInterval, defaultFastInterval)
+	before := minutesOr(p.WindowBefore, defaultWindowBefore)
+	after := minutesOr(p.WindowAfter, defaultWindowAfter)
+	idle := minutesOr(p.IdleInterval, defaultIdleInterval)
+	horizon := minutesOr(p.IdleHorizon, defaultIdleHorizon)
+
+	view := s.View()
+	if !view.Status.Available {
+		return base, PollNormal // 不知道空投时间，不能据此放慢
+	}
+	now := s.now()
+	var items []SnapshotItem
+	for _, a := range view.Airdrops {
+		items = append(items, SnapshotItem{Token: a.Token, Name: a.Name, Date: a.Date, Time: a.Time, Amount: a.Amount, Phase: a.Phase})
+	}
+	s.sortSnapshotItems(items)
+
+	interval, reason := base, PollNormal
+	nearest := time.Duration(-1) // 距下一个开始时间，-1表示没有
+	var wakeups []time.Time      // 需要准时醒来的时刻：开始窗口和提醒
+	for _, item := range items {
+		startsAt := s.StartTime(item.Date, item.Time)
+		if startsAt == nil {
+			continue
+		}
+		start := *startsAt
+		if !now.Before(start.Add(-before)) && now.Before(start.Add(after)) {
+			return maxDuration(fast, minPollInterval), PollFast
+		}
+		if now.Before(start) {
+			if nearest < 0 {
+				nearest = start.Sub(now) // 已按时间排序，第一个即最近的
+			}
+			wakeups = append(wakeups, start.Add(-before))
+			for _, m := range s.config.Reminders.Minutes {
+				wakeups = append(wakeups, start.Add(-time.Duration(m)*time.Minute))
+			}
+		}
+	}
+
+	switch {
+	case inQuietHours(p.QuietHours, now.In(s.config.Location())):
+		interval, reason = idle, PollQuiet
+	case nearest < 0 || nearest > horizon:
+		interval, reason = idle, PollIdle
+	}
+
+	for _, w := range wakeups {
+		if d := w.Sub(now); d > 0 && d < interval {
+			interval, reason = d, PollWake
+		}
+	}
+	return maxDuration(interval, minPollInterval), reason
+}
+
+// maxDuration 返回较大的时长
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Describe 返回自适应间隔的配置摘要，用于启动日志
+func (p PollingConfig) Describe() string {
+	if !p.Adaptive {
+		return "fixed"
+	}
+	return fmt.Sprintf("fast=%s window=-%s/+%s idle=%s quiet=%q",
+		minutesOr(p.FastInterval, defaultFastInterval), minutesOr(p.WindowBefore, defaultWindowBefore),
+		minutesOr(p.WindowAfter, defaultWindowAfter), minutesOr(p.IdleInterval, defaultIdleInterval), p.QuietHours)
+}
@@ -0,0 +1,106 @@
+package internal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInQuietHours(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2025, 9, 10, hour, minute, 0, 0, time.UTC) }
+	cases := []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"01:00-08:00", at(0, 59), false},
+		{"01:00-08:00", at(1, 0), true},
+		{"01:00-08:00", at(7, 59), true},
+		{"01:00-08:00", at(8, 0), false},
+		// 跨零点
+		{"23:00-07:00", at(23, 0), true},
+		{"23:00-07:00", at(2, 0), true},
+		{"23:00-07:00", at(6, 59), true},
+		{"23:00-07:00", at(7, 0), false},
+		{"23:00-07:00", at(12, 0), false},
+		{" 23:00 - 07:00 ", at(2, 0), true},
+		// 格式错误或空时段
+		{"", at(2, 0), false},
+		{"0100-0800", at(2, 0), false},
+		{"25:00-08:00", at(2, 0), false},
+		{"08:00-08:00", at(8, 0), false},
+	}
+	for _, c := range cases {
+		if got := inQuietHours(c.spec, c.t); got != c.want {
+			t.Errorf("%q在%s: 期望%v，实际%v", c.spec, c.t.Format("15:04"), c.want, got)
+		}
+	}
+}
+
+func TestNextInterval(t *testing.T) {
+	noon := time.Date(2025, 9, 10, 12, 0, 0, 0, time.UTC)
+	// at 生成今天hh:mm开始的空投
+	at := func(hhmm string) PricedAirdrop {
+		return PricedAirdrop{Airdrop: Airdrop{Token: "T" + hhmm, Date: "2025-09-10", Time: hhmm}}
+	}
+	adaptive := PollingConfig{Adaptive: true}
+
+	cases := []struct {
+		name       string
+		polling    PollingConfig
+		reminders  []int
+		now        time.Time
+		available  bool
+		airdrops   []PricedAirdrop
+		want       time.Duration
+		wantReason string
+	}{
+		{"未开启自适应", PollingConfig{}, nil, noon, true, []PricedAirdrop{at("12:30")}, 5 * time.Minute, PollFixed},
+		{"没有拿到数据", adaptive, nil, noon, false, nil, 5 * time.Minute, PollNormal},
+		{"没有空投", adaptive, nil, noon, true, nil, 15 * time.Minute, PollIdle},
+		{"开始前窗口内", adaptive, nil, noon, true, []PricedAirdrop{at("12:30")}, time.Minute, PollFast},
+		{"开始后窗口内", adaptive, nil, noon, true, []PricedAirdrop{at("11:50")}, time.Minute, PollFast},
+		{"已离开开始后窗口", adaptive, nil, noon, true, []PricedAirdrop{at("11:40")}, 15 * time.Minute, PollIdle},
+		{"自定义窗口", PollingConfig{Adaptive: true, WindowBefore: 10, FastInterval: 2}, nil, noon, true, []PricedAirdrop{at("12:08")}, 2 * time.Minute, PollFast},
+		{"附近有空投但未到窗口", adaptive, nil, noon, true, []PricedAirdrop{at("14:00")}, 5 * time.Minute, PollNormal},
+		{"提前醒来赶上开始窗口", adaptive, nil, noon, true, []PricedAirdrop{at("13:03")}, 3 * time.Minute, PollWake},
+		{"提前醒来发送提醒", adaptive, []int{90}, noon, true, []PricedAirdrop{at("13:32")}, 2 * time.Minute, PollWake},
+		{"超过idleHorizon视为空闲", adaptive, nil, noon, true, []PricedAirdrop{at("20:00")}, 15 * time.Minute, PollIdle},
+		{"夜间时段", PollingConfig{Adaptive: true, QuietHours: "23:00-07:00"}, nil, noon.Add(-10 * time.Hour), true,
+			[]PricedAirdrop{at("06:00")}, 15 * time.Minute, PollQuiet},
+		{"夜间时段也为开始窗口醒来", PollingConfig{Adaptive: true, QuietHours: "23:00-07:00"}, nil, noon.Add(-10 * time.Hour), true,
+			[]PricedAirdrop{at("03:10")}, 10 * time.Minute, PollWake},
+		{"夜间的开始窗口内仍加快", PollingConfig{Adaptive: true, QuietHours: "23:00-07:00"}, nil, noon.Add(-10 * time.Hour), true,
+			[]PricedAirdrop{at("02:30")}, time.Minute, PollFast},
+		{"不短于30秒", adaptive, nil, noon.Add(50 * time.Second), true, []PricedAirdrop{at("13:01")}, 30 * time.Second, PollWake},
+		{"开始时间未知的空投不参与", adaptive, nil, noon, true,
+			[]PricedAirdrop{{Airdrop: Airdrop{Token: "X", Date: "待定"}}}, 15 * time.Minute, PollIdle},
+	}
+	for _, c := range cases {
+		cfg := &Config{Interval: 5, Timezone: "UTC", Polling: c.polling, Reminders: ReminderConfig{Minutes: c.reminders}}
+		s := &AirdropService{config: cfg, replayClock: c.now}
+		s.view = AirdropView{Status: DataStatus{Available: c.available}, Airdrops: c.airdrops}
+		got, reason := s.NextInterval()
+		if got != c.want || reason != c.wantReason {
+			t.Errorf("%s: 期望(%v, %s)，实际(%v, %s)", c.name, c.want, c.wantReason, got, reason)
+		}
+	}
+}
+
+func TestNextIntervalQuietHoursTimezone(t *testing.T) {
+	// 夜间时段按配置的时区解释：UTC 16:00为北京时间0:00
+	now := time.Date(2025, 9, 10, 16, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		timezone string
+		want     string
+	}{
+		{"Asia/Shanghai", PollQuiet},
+		{"UTC", PollIdle},
+	} {
+		cfg := &Config{Interval: 5, Timezone: c.timezone, Polling: PollingConfig{Adaptive: true, QuietHours: "23:00-07:00"}}
+		s := &AirdropService{config: cfg, replayClock: now}
+		s.view = AirdropView{Status: DataStatus{Available: true}}
+		if _, reason := s.NextInterval(); reason != c.want {
+			t.Errorf("timezone=%s: 期望%s，实际%s", c.timezone, c.want, reason)
+		}
+	}
+}
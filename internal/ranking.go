@@ -0,0 +1,68 @@
+// Package internal 包含项目的核心功能实现
+// 该文件计算每个空投的每分价值（估值除以所需积分）和在当前窗口内的排名，
+// 并按配置的方式排列消息表格
+package internal
+
+import (
+	"context" // 用于日志
+	"sort"    // 用于排序
+)
+
+// 消息表格的排列方式
+const (
+	SortByTime          = "time"          // 按开始时间（默认）
+	SortByValue         = "value"         // 按估值从高到低
+	SortByValuePerPoint = "valuePerPoint" // 按每分价值从高到低
+)
+
+// MessageConfig 推送消息的格式配置
+type MessageConfig struct {
+	Sort string `json:"sort"` // 表格的排列方式：time、value或valuePerPoint，默认time
+}
+
+// sortOrder 返回有效的排列方式，未配置或无法识别时为SortByTime
+func (m MessageConfig) sortOrder(ctx context.Context) string {
+	switch m.Sort {
+	case "", SortByTime:
+		return SortByTime
+	case SortByValue, SortByValuePerPoint:
+		return m.Sort
+	default:
+		Logger(ctx).Warn("无法识别的message.sort，按时间排列", "sort", m.Sort)
+		return SortByTime
+	}
+}
+
+// rankAirdrops 计算每个空投的每分价值和排名
+// 只有查到价格且积分为正数的空投参与排名，排名从1开始，每分价值相同时保持原顺序；其余的Rank为0
+func rankAirdrops(airdrops []PricedAirdrop) {
+	var ranked []*PricedAirdrop
+	for i := range airdrops {
+		a := &airdrops[i]
+		a.ValuePerPoint, a.Rank = 0, 0
+		points, ok := parsePoints(pointsString(a.Points))
+		if !ok || points <= 0 || !a.PriceAvailable {
+			continue
+		}
+		a.ValuePerPoint = a.Value / float64(points)
+		ranked = append(ranked, a)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].ValuePerPoint > ranked[j].ValuePerPoint })
+	for i, a := range ranked {
+		a.Rank = i + 1
+	}
+}
+
+// sortAirdrops 按排列方式重新排列已按时间排好的空投，相同时保持时间顺序
+// 按每分价值排列时，没有排名的空投放在最后
+func sortAirdrops(airdrops []PricedAirdrop, order string) {
+	switch order {
+	case SortByValue:
+		sort.SliceStable(airdrops, func(i, j int) bool { return airdrops[i].Value > airdrops[j].Value })
+	case SortByValuePerPoint:
+		sort.SliceStable(airdrops, func(i, j int) bool {
+			ri, rj := airdrops[i].Rank, airdrops[j].Rank
+			return ri != 0 && (rj == 0 || ri < rj)
+		})
+	}
+}
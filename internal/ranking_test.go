@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// priced 生成用于排名测试的空投，priceAvailable为false时没有价格
+func priced(token string, points interface{}, value float64, priceAvailable bool) PricedAirdrop {
+	return PricedAirdrop{
+		Airdrop:        Airdrop{Token: token, Points: points},
+		Value:          value,
+		PriceAvailable: priceAvailable,
+	}
+}
+
+// tokens 返回空投的代币顺序
+func tokens(airdrops []PricedAirdrop) []string {
+	out := make([]string, 0, len(airdrops))
+	for _, a := range airdrops {
+		out = append(out, a.Token)
+	}
+	return out
+}
+
+func TestRankAirdrops(t *testing.T) {
+	airdrops := []PricedAirdrop{
+		priced("A", "200", 100, true), // 0.5
+		priced("B", 100.0, 100, true), // 1
+		priced("C", "50分", 100, true), // 2，积分带单位
+		priced("D", "200", 0, false),  // 没有价格
+		priced("E", "0", 100, true),   // 积分为0
+		priced("F", nil, 100, true),   // 没有积分
+		priced("G", 200, 100, true),   // 0.5，与A相同时保持原顺序
+		priced("H", "待公布", 100, true), // 积分无法识别
+	}
+	airdrops[3].Rank, airdrops[3].ValuePerPoint = 9, 9 // 上次的结果应被清除
+
+	rankAirdrops(airdrops)
+
+	want := []struct {
+		rank          int
+		valuePerPoint float64
+	}{
+		{3, 0.5}, {2, 1}, {1, 2}, {0, 0}, {0, 0}, {0, 0}, {4, 0.5}, {0, 0},
+	}
+	for i, w := range want {
+		a := airdrops[i]
+		if a.Rank != w.rank || a.ValuePerPoint != w.valuePerPoint {
+			t.Errorf("%s: 期望排名%d每分价值%v，实际%d %v", a.Token, w.rank, w.valuePerPoint, a.Rank, a.ValuePerPoint)
+		}
+	}
+}
+
+func TestSortAirdrops(t *testing.T) {
+	// 已按时间排好：A、B、C、D
+	base := func() []PricedAirdrop {
+		list := []PricedAirdrop{
+			priced("A", "100", 50, true),  // 每分0.5
+			priced("B", "100", 200, true), // 每分2
+			priced("C", "100", 0, false),  // 没有价格
+			priced("D", "50", 100, true),  // 每分2，与B相同
+		}
+		rankAirdrops(list)
+		return list
+	}
+	cases := []struct {
+		order string
+		want  []string
+	}{
+		{SortByTime, []string{"A", "B", "C", "D"}},
+		{SortByValue, []string{"B", "D", "A", "C"}},
+		{SortByValuePerPoint, []string{"B", "D", "A", "C"}},
+		{"unknown", []string{"A", "B", "C", "D"}},
+	}
+	for _, c := range cases {
+		list := base()
+		sortAirdrops(list, c.order)
+		if got := tokens(list); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("按%s排列: 期望%v，实际%v", c.order, c.want, got)
+		}
+	}
+}
+
+func TestMessageSortOrder(t *testing.T) {
+	cases := []struct {
+		sort string
+		want string
+	}{
+		{"", SortByTime},
+		{SortByTime, SortByTime},
+		{SortByValue, SortByValue},
+		{SortByValuePerPoint, SortByValuePerPoint},
+		{"price", SortByTime},
+	}
+	for _, c := range cases {
+		if got := (MessageConfig{Sort: c.sort}).sortOrder(context.Background()); got != c.want {
+			t.Errorf("message.sort=%q: 期望%s，实际%s", c.sort, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package internal 包含项目的核心功能实现
+// 该文件定义推送接收人：除了SendKey，还可以带上接收人当前的Alpha积分，
+// 推送时为每个接收人单独生成带资格列的表格，并按资格排序或过滤
+package internal
+
+import (
+	"context"       // 用于取消推送
+	"encoding/json" // 用于兼容字符串形式的配置
+	"fmt"           // 用于格式化
+	"log/slog"      // 用于兼容旧配置时的提示
+	"os"            // 用于读取积分文件
+	"sort"          // 用于按资格排序
+	"strconv"       // 用于解析积分文件
+	"strings"       // 用于字符串处理
+	"time"          // 用于计算滚动积分
+)
+
+// 资格列的使用方式
+const (
+	EligibilityMark   = "mark"   // 只标注，保持时间顺序（默认）
+	EligibilitySort   = "sort"   // 达到门槛的排在前面
+	EligibilityFilter = "filter" // 只保留达到门槛的，没有时不推送
+)
+
+// Recipient 推送接收人
+// config.json中可以直接写SendKey字符串，也可以写成对象以配置积分
+type Recipient struct {
+	SendKey     string `json:"sendkey"`               // Server酱的推送密钥
+	Points      *int   `json:"points,omitempty"`      // 当前Alpha积分，未配置时消息中没有资格列
+	PointsFile  string `json:"pointsFile,omitempty"`  // 积分文件，内容为一个整数，每次推送前读取，优先于points
+	Ledger      string `json:"ledger,omitempty"`      // 积分账本中的成员名，使用最近15天的滚动积分，优先于pointsFile和points
+	Eligibility string `json:"eligibility,omitempty"` // 资格列的使用方式：mark、sort或filter，默认mark
+}
+
+// UnmarshalJSON 同时支持"SCTxxx"和{"sendkey": "SCTxxx", "points": 230}两种写法
+func (r *Recipient) UnmarshalJSON(data []byte) error {
+	var key string
+	if err := json.Unmarshal(data, &key); err == nil {
+		*r = Recipient{SendKey: key}
+		return nil
+	}
+	type plain Recipient // 避免递归调用UnmarshalJSON
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("sendkeys的每一项必须是字符串或对象: %v", err)
+	}
+	*r = Recipient(p)
+	return nil
+}
+
+// Balance 返回接收人当前的积分
+// 参数:
+//   - cfg: 配置信息，用于定位积分账本
+//   - now: 当前时间，用于计算滚动积分
+// 返回:
+//   - int: 积分
+//   - bool: 是否配置了积分，未配置时不显示资格列
+//   - error: 积分账本或积分文件读取失败、账本中没有该成员时返回错误
+func (r Recipient) Balance(cfg *Config, now time.Time) (int, bool, error) {
+	if r.Ledger != "" {
+		ledger, err := LoadLedger(cfg)
+		if err != nil {
+			return 0, false, err
+		}
+		score, ok := ledger.Score(r.Ledger, now.In(cfg.Location()))
+		if !ok {
+			return 0, false, fmt.Errorf("积分账本中没有成员%s", r.Ledger)
+		}
+		return score, true, nil
+	}
+	if r.PointsFile != "" {
+		data, err := os.ReadFile(r.PointsFile)
+		if err != nil {
+			return 0, false, err
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+		if err != nil {
+			return 0, false, fmt.Errorf("解析积分文件失败: %v", err)
+		}
+		return n, true, nil
+	}
+	if r.Points != nil {
+		return *r.Points, true, nil
+	}
+	return 0, false, nil
+}
+
+// PointsBalance 旧版pointsBalances配置中的一项，已由Recipient的points取代
+type PointsBalance struct {
+	SendKey string `json:"sendkey"` // 接收人的SendKey
+	Points  int    `json:"points"`  // 当前积分
+}
+
+// foldPointsBalances 把旧版pointsBalances中的积分合并到sendkeys中相同SendKey的接收人
+// 接收人已经配置了积分时保留新写法；不在sendkeys中的SendKey忽略并提示
+func (c *Config) foldPointsBalances() {
+	if len(c.PointsBalances) == 0 {
+		return
+	}
+	slog.Warn("pointsBalances已弃用，请改为在sendkeys中写{\"sendkey\": ..., \"points\": ...}")
+	for _, b := range c.PointsBalances {
+		found := false
+		for i := range c.SendKeys {
+			r := &c.SendKeys[i]
+			if r.SendKey != b.SendKey {
+				continue
+			}
+			found = true
+			if r.Points == nil && r.PointsFile == "" && r.Ledger == "" {
+				points := b.Points
+				r.Points = &points
+			}
+		}
+		if !found {
+			slog.Warn("pointsBalances中的SendKey不在sendkeys中，已忽略", LogKeyRecipient, recipientLabel(b.SendKey))
+		}
+	}
+	c.PointsBalances = nil
+}
+
+// sendKeyList 返回所有接收人的SendKey
+func (c *Config) sendKeyList() []string {
+	keys := make([]string, 0, len(c.SendKeys))
+	for _, r := range c.SendKeys {
+		keys = append(keys, r.SendKey)
+	}
+	return keys
+}
+
+// recipientsFromKeys 用环境变量或文件中的SendKey生成接收人
+// config.json中有相同SendKey的对象时沿用其积分设置
+func recipientsFromKeys(keys []string, configured []Recipient) []Recipient {
+	recipients := make([]Recipient, 0, len(keys))
+	for _, key := range keys {
+		r := Recipient{SendKey: key}
+		for _, c := range configured {
+			if c.SendKey == key {
+				r = c
+				break
+			}
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients
+}
+
+// eligibilityMark 资格列的内容：达到门槛为"✅"，否则为"差N分"，积分无法解析时为"-"
+func eligibilityMark(points string, balance int) string {
+	need, ok := parsePoints(points)
+	if !ok {
+		return "-"
+	}
+	if balance >= need {
+		return "✅"
+	}
+	return fmt.Sprintf("差%d分", need-balance)
+}
+
+// eligibilityRank 排序用的资格等级：达到门槛为0，积分未知为1，未达到为2
+func eligibilityRank(points string, balance int) int {
+	need, ok := parsePoints(points)
+	switch {
+	case !ok:
+		return 1
+	case balance >= need:
+		return 0
+	default:
+		return 2
+	}
+}
+
+// arrange 按接收人的资格设置排列空投，不修改传入的切片
+// sort时达到门槛的排在前面，同一等级内保持时间顺序；filter时去掉未达到门槛的，积分未知的保留
+func (r Recipient) arrange(airdrops []PricedAirdrop, balance int) []PricedAirdrop {
+	out := make([]PricedAirdrop, 0, len(airdrops))
+	for _, a := range airdrops {
+		if r.Eligibility == EligibilityFilter && eligibilityRank(pointsString(a.Points), balance) == 2 {
+			continue
+		}
+		out = append(out, a)
+	}
+	if r.Eligibility == EligibilitySort {
+		sort.SliceStable(out, func(i, j int) bool {
+			return eligibilityRank(pointsString(out[i].Points), balance) < eligibilityRank(pointsString(out[j].Points), balance)
+		})
+	}
+	return out
+}
+
+// SendToRecipients 向所有接收人推送空投消息
+// 配置了积分的接收人收到按最近一次检查结果单独生成的表格，带资格列；其余接收人收到msg
+// 参数:
+//   - ctx: 控制取消的上下文，取消后不再发送剩余的接收人
+//   - msg: GenerateMessageAndSnapshot生成的通用消息
+//   - title: 消息标题
+// 返回:
+//   - error: ctx被取消时返回ctx.Err()，单个接收人的发送错误只打印到控制台
+func (s *AirdropService) SendToRecipients(ctx context.Context, msg string, title string) error {
+	logger := Logger(ctx)
+	view := s.View()
+	for _, r := range s.config.SendKeys {
+		body := msg
+		balance, ok, err := r.Balance(s.config, s.now())
+		if err != nil {
+			logger.Warn("读取接收人积分失败，发送不带资格列的消息", LogKeyRecipient, recipientLabel(r.SendKey), LogKeyError, err)
+		} else if ok {
+			rows := r.arrange(view.Airdrops, balance)
+			if len(rows) == 0 {
+				logger.Info("没有达到积分门槛的空投，跳过该接收人", LogKeyRecipient, recipientLabel(r.SendKey))
+				continue
+			}
+			body = renderMessage(view.Status, rows, view.PriceSuspended, &balance)
+		}
+		if err := sendToKeys(ctx, body, title, s.config, []string{r.SendKey}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
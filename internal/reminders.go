@@ -0,0 +1,136 @@
+// Package internal 包含项目的核心功能实现
+// 该文件实现空投开始前的提醒：在每个空投开始前配置的分钟数推送一次，
+// 已发送的提醒记录在状态目录中，重启后不会重复发送
+package internal
+
+import (
+	"context"       // 用于取消推送
+	"encoding/json" // 用于提醒记录的编解码
+	"fmt"           // 用于格式化消息
+	"os"            // 用于读写提醒记录
+	"sort"          // 用于按开始时间排列
+	"time"          // 用于时间计算
+)
+
+// remindersFile 已发送提醒的记录文件名，位于状态目录下
+const remindersFile = "reminders_sent.json"
+
+// reminderRetention 提醒记录在空投开始后保留的时间，之后清理
+const reminderRetention = 48 * time.Hour
+
+// ReminderConfig 开始前提醒配置
+type ReminderConfig struct {
+	Minutes []int `json:"minutes"` // 开始前多少分钟提醒，如[30, 5]；为空表示不提醒
+}
+
+// reminderKey 提醒记录的键：空投、开始时间和提醒offset
+// 包含开始时间，空投改期后会按新时间重新提醒
+func reminderKey(a PricedAirdrop, start time.Time, minutes int) string {
+	return fmt.Sprintf("%s|%d|%s|%d", a.Token, a.Phase, start.Format(time.RFC3339), minutes)
+}
+
+// dueReminder 一条到期的提醒
+type dueReminder struct {
+	airdrop PricedAirdrop
+	start   time.Time
+	keys    []string // 本次一并标记为已发送的记录，多个offset同时到期时只发一次
+}
+
+// loadReminderLog 读取已发送的提醒，键为reminderKey，值为空投开始时间
+func loadReminderLog(path string) (map[string]time.Time, error) {
+	sent := make(map[string]time.Time)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sent, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &sent); err != nil {
+		return nil, fmt.Errorf("解析提醒记录失败: %v", err)
+	}
+	return sent, nil
+}
+
+// SendReminders 为即将开始的空投发送提醒
+// 只处理最近一次检查中过滤后的空投，被覆盖文件snooze的项目跳过；
+// 同一空投的多个提醒同时到期时（如程序刚启动）只发送一条
+// 参数:
+//   - ctx: 控制取消的上下文
+func (s *AirdropService) SendReminders(ctx context.Context) {
+	offsets := s.config.Reminders.Minutes
+	view := s.View()
+	if len(offsets) == 0 || !view.Status.Available || view.Status.Stale || s.replaying() {
+		return
+	}
+	logger := Logger(ctx)
+	path := s.config.StatePath(remindersFile)
+	sent, err := loadReminderLog(path)
+	if err != nil {
+		logger.Error("读取提醒记录失败，本次不发送提醒", LogKeyPath, path, LogKeyError, err)
+		return
+	}
+
+	now := s.now()
+	var due []dueReminder
+	for _, a := range view.Airdrops {
+		if a.StartsAt == nil || a.Snoozed || !now.Before(*a.StartsAt) {
+			continue
+		}
+		start := *a.StartsAt
+		var keys []string
+		for _, minutes := range offsets {
+			key := reminderKey(a, start, minutes)
+			if _, ok := sent[key]; ok {
+				continue
+			}
+			if !now.Before(start.Add(-time.Duration(minutes) * time.Minute)) {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) > 0 {
+			due = append(due, dueReminder{airdrop: a, start: start, keys: keys})
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].start.Before(due[j].start) })
+
+	title := fmt.Sprintf("%d个空投即将开始", len(due))
+	if len(due) == 1 {
+		title = fmt.Sprintf("%s 还有%d分钟开始", due[0].airdrop.Token, minutesUntil(now, due[0].start))
+	}
+	msg := "| 项目 | 开始时间 | 剩余 | 积分 | 数量 | 阶段 |\n|---|---|---|---|---|---|\n"
+	for _, d := range due {
+		a := d.airdrop
+		msg += fmt.Sprintf("| %s(%s) | %s %s | %d分钟 | %s | %s | %d |\n",
+			a.Token, a.Name, a.Date, a.Time, minutesUntil(now, d.start), pointsString(a.Points), a.Amount, a.Phase)
+	}
+
+	logger.Info("发送开始前提醒", LogKeyCount, len(due))
+	if err := SendToServerChan(ctx, msg, title, s.config); err != nil {
+		logger.Error("提醒推送中止", LogKeyError, err)
+		return // 没有发完，下个周期重试
+	}
+
+	for _, d := range due {
+		for _, key := range d.keys {
+			sent[key] = d.start
+		}
+	}
+	for key, start := range sent {
+		if now.Sub(start) > reminderRetention {
+			delete(sent, key)
+		}
+	}
+	data, _ := json.Marshal(sent)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		logger.Error("保存提醒记录失败", LogKeyPath, path, LogKeyError, err)
+	}
+}
+
+// minutesUntil 返回距开始的分钟数，向上取整
+func minutesUntil(now, start time.Time) int {
+	return int((start.Sub(now) + time.Minute - 1) / time.Minute)
+}
@@ -0,0 +1,347 @@
+// Package internal 包含项目的核心功能实现
+// 该文件提供上游请求的重试策略（指数退避、抖动、Retry-After）和熔断器
+package internal
+
+import (
+	"context"       // 用于取消和超时控制
+	"encoding/json" // 用于保存熔断器状态
+	"errors"        // 用于定义哨兵错误
+	"log/slog"      // 用于记录保存失败
+	"math/rand/v2"  // 用于生成退避抖动
+	"net/http"      // 用于解析Retry-After响应头
+	"os"            // 用于读写熔断器状态文件
+	"strconv"       // 用于解析Retry-After秒数
+	"sync"          // 用于保护熔断器状态
+	"time"          // 用于时间处理
+)
+
+// RetryConfig 单个上游接口的重试配置，从config.json的retry字段中按接口名加载
+// 所有字段为0时使用该接口的默认值
+type RetryConfig struct {
+	MaxAttempts int     `json:"maxAttempts"` // 最多尝试次数（包含第一次请求）
+	BaseDelay   int     `json:"baseDelay"`   // 第一次重试前的等待时间（秒），之后按指数增长
+	MaxDelay    int     `json:"maxDelay"`    // 单次等待的上限（秒）
+	Jitter      float64 `json:"jitter"`      // 抖动比例，0.2表示在退避时间上下浮动20%
+}
+
+// BreakerConfig 熔断器配置
+type BreakerConfig struct {
+	Threshold int `json:"threshold"` // 连续多少次403/5xx后打开熔断器
+	Cooldown  int `json:"cooldown"`  // 打开后的冷却时间（秒），冷却结束后放行一次探测请求
+}
+
+// 上游接口名称，对应config.json中retry字段的键
+const (
+	EndpointData  = "data"  // 空投数据接口 /api/data
+	EndpointPrice = "price" // 价格接口 /api/price/{token}
+)
+
+// defaultRetryConfigs 各接口的默认重试配置
+var defaultRetryConfigs = map[string]RetryConfig{
+	EndpointData:  {MaxAttempts: 3, BaseDelay: 3, MaxDelay: 30, Jitter: 0.2},
+	EndpointPrice: {MaxAttempts: 2, BaseDelay: 3, MaxDelay: 15, Jitter: 0.2},
+	EndpointHTML:  {MaxAttempts: 2, BaseDelay: 3, MaxDelay: 15, Jitter: 0.2},
+}
+
+// defaultBreakerConfig 价格接口熔断器的默认配置
+var defaultBreakerConfig = BreakerConfig{Threshold: 3, Cooldown: 300}
+
+// RetryPolicy 重试策略
+// 第n次重试前等待 BaseDelay * 2^(n-1)，不超过MaxDelay，并叠加随机抖动
+type RetryPolicy struct {
+	MaxAttempts int           // 最多尝试次数
+	BaseDelay   time.Duration // 基础等待时间
+	MaxDelay    time.Duration // 等待时间上限
+	Jitter      float64       // 抖动比例
+	NoWait      bool          // 不等待直接重试，回放时使用，使结果与机器状态和耗时无关
+}
+
+// RetryPolicyFor 返回指定接口的重试策略
+// 配置中未设置的字段使用默认值；回放模式下保留尝试次数，但重试之间不等待
+// 参数:
+//   - endpoint: 接口名称，如EndpointData、EndpointPrice
+// 返回:
+//   - RetryPolicy: 合并默认值后的重试策略
+func (c *Config) RetryPolicyFor(endpoint string) RetryPolicy {
+	rc := defaultRetryConfigs[endpoint]
+	if c != nil {
+		if override, ok := c.Retry[endpoint]; ok {
+			if override.MaxAttempts > 0 {
+				rc.MaxAttempts = override.MaxAttempts
+			}
+			if override.BaseDelay > 0 {
+				rc.BaseDelay = override.BaseDelay
+			}
+			if override.MaxDelay > 0 {
+				rc.MaxDelay = override.MaxDelay
+			}
+			if override.Jitter > 0 {
+				rc.Jitter = override.Jitter
+			}
+		}
+	}
+	if rc.MaxAttempts <= 0 {
+		rc.MaxAttempts = 1
+	}
+	if c != nil && c.Capture.Mode == CaptureReplay {
+		return RetryPolicy{MaxAttempts: rc.MaxAttempts, NoWait: true}
+	}
+	return RetryPolicy{
+		MaxAttempts: rc.MaxAttempts,
+		BaseDelay:   time.Duration(rc.BaseDelay) * time.Second,
+		MaxDelay:    time.Duration(rc.MaxDelay) * time.Second,
+		Jitter:      rc.Jitter,
+	}
+}
+
+// PriceBreakerConfig 返回价格接口熔断器配置，未设置的字段使用默认值
+func (c *Config) PriceBreakerConfig() BreakerConfig {
+	bc := defaultBreakerConfig
+	if c != nil {
+		if c.PriceBreaker.Threshold > 0 {
+			bc.Threshold = c.PriceBreaker.Threshold
+		}
+		if c.PriceBreaker.Cooldown > 0 {
+			bc.Cooldown = c.PriceBreaker.Cooldown
+		}
+	}
+	return bc
+}
+
+// Backoff 计算第attempt次请求失败后的等待时间
+// 参数:
+//   - attempt: 刚刚失败的是第几次尝试，从1开始
+// 返回:
+//   - time.Duration: 指数退避并加上抖动后的等待时间
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		// 在[1-Jitter, 1+Jitter]范围内随机缩放，避免多个实例同时重试
+		factor := 1 + p.Jitter*(2*rand.Float64()-1)
+		delay = time.Duration(float64(delay) * factor)
+	}
+	return delay
+}
+
+// Wait 在下一次重试前等待
+// 如果响应带有Retry-After头，则至少等待其要求的时长
+// 参数:
+//   - ctx: 控制取消的上下文
+//   - attempt: 刚刚失败的是第几次尝试
+//   - resp: 失败的HTTP响应，网络错误时为nil
+// 返回:
+//   - time.Duration: 实际等待的时长
+//   - error: ctx被取消时返回ctx.Err()
+func (p RetryPolicy) Wait(ctx context.Context, attempt int, resp *http.Response) (time.Duration, error) {
+	if p.NoWait {
+		return 0, ctx.Err()
+	}
+	delay := p.Backoff(attempt)
+	if after, ok := retryAfter(resp); ok && after > delay {
+		delay = after
+	}
+	return delay, sleepWithContext(ctx, delay)
+}
+
+// retryAfter 解析响应中的Retry-After头
+// 支持秒数和HTTP日期两种格式
+// 参数:
+//   - resp: HTTP响应，可以为nil
+// 返回:
+//   - time.Duration: 服务器要求的等待时长
+//   - bool: 是否存在有效的Retry-After头
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if when, err := http.ParseTime(value); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// isBreakerFailure 判断状态码是否应计入熔断器失败次数
+// 403（被反爬虫拦截）和5xx（服务端故障）说明继续请求只会加重问题
+func isBreakerFailure(statusCode int) bool {
+	return statusCode == http.StatusForbidden || statusCode >= 500
+}
+
+// ErrCircuitOpen 熔断器处于打开状态时返回的错误
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常放行请求
+	BreakerOpen     = "open"      // 冷却中，拒绝请求
+	BreakerHalfOpen = "half-open" // 冷却结束，放行一次探测请求
+)
+
+// priceBreakerFile 价格接口熔断器状态文件名，位于状态目录下
+// run模式每次都是新进程，保存状态后连续失败和冷却时间才能跨越多次运行
+const priceBreakerFile = "price_breaker.json"
+
+// CircuitBreaker 熔断器
+// 连续Threshold次失败后打开，冷却Cooldown后进入半开状态放行一次探测请求，
+// 探测成功则关闭，失败则重新打开；探测有结果之前其他请求仍被拒绝
+type CircuitBreaker struct {
+	mu        sync.Mutex
+	threshold int           // 打开前允许的连续失败次数
+	cooldown  time.Duration // 打开后的冷却时间
+	failures  int           // 当前连续失败次数
+	openedAt  time.Time     // 最近一次打开的时间
+	state     string        // 当前状态
+	probing   bool          // 半开状态下是否已放行探测请求，记录结果或放弃后清除
+	path      string        // 状态文件路径，为空时只保存在内存中
+}
+
+// breakerState 保存在状态文件中的熔断器状态
+// 半开状态不保存：进程在探测中退出时按打开保存，冷却已结束，下次运行重新探测
+type breakerState struct {
+	State    string    `json:"state"`              // closed或open
+	Failures int       `json:"failures"`           // 连续失败次数
+	OpenedAt time.Time `json:"openedAt,omitempty"` // 最近一次打开的时间
+}
+
+// NewCircuitBreaker 创建熔断器实例
+// 参数:
+//   - cfg: 熔断器配置
+// 返回:
+//   - *CircuitBreaker: 处于关闭状态的熔断器
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: cfg.Threshold,
+		cooldown:  time.Duration(cfg.Cooldown) * time.Second,
+		state:     BreakerClosed,
+	}
+}
+
+// LoadCircuitBreaker 创建熔断器，并从状态文件恢复上次运行结束时的状态
+// 之后失败计数或状态变化时写回该文件
+// 参数:
+//   - cfg: 熔断器配置
+//   - path: 状态文件路径，文件不存在或无法解析时从关闭状态开始
+// 返回:
+//   - *CircuitBreaker: 熔断器实例
+func LoadCircuitBreaker(cfg BreakerConfig, path string) *CircuitBreaker {
+	b := NewCircuitBreaker(cfg)
+	b.path = path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Error("读取熔断器状态失败", LogKeyPath, path, LogKeyError, err)
+		}
+		return b
+	}
+	var saved breakerState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		slog.Error("解析熔断器状态失败，从关闭状态开始", LogKeyPath, path, LogKeyError, err)
+		return b
+	}
+	b.failures, b.openedAt = saved.Failures, saved.OpenedAt
+	if saved.State == BreakerOpen {
+		b.state = BreakerOpen
+	}
+	return b
+}
+
+// save 把状态写入状态文件，调用方持有锁
+func (b *CircuitBreaker) save() {
+	if b.path == "" {
+		return
+	}
+	state := b.state
+	if state == BreakerHalfOpen {
+		state = BreakerOpen
+	}
+	data, err := json.MarshalIndent(breakerState{State: state, Failures: b.failures, OpenedAt: b.openedAt}, "", "  ")
+	if err == nil {
+		err = os.WriteFile(b.path, data, 0644)
+	}
+	if err != nil {
+		slog.Error("保存熔断器状态失败", LogKeyPath, b.path, LogKeyError, err)
+	}
+}
+
+// Allow 判断当前是否允许发起请求
+// 冷却时间结束后转为半开状态，只放行一个探测请求，直到调用RecordSuccess、RecordFailure或Abort
+// 放行后必须调用三者之一，否则半开状态会一直拒绝请求
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		b.state = BreakerHalfOpen
+	}
+	switch b.state {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Abort 放弃已放行的请求，请求没有得到能判断接口状态的响应时调用（如网络错误、取消）
+// 半开状态下释放探测名额，下一个请求重新探测；不影响失败计数
+func (b *CircuitBreaker) Abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// RecordSuccess 记录一次成功请求，关闭熔断器并清零失败计数
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	changed := b.failures != 0 || b.state != BreakerClosed
+	b.failures = 0
+	b.state = BreakerClosed
+	b.probing = false
+	if changed {
+		b.save() // 大多数请求都成功，状态没有变化时不写文件
+	}
+}
+
+// RecordFailure 记录一次403/5xx失败
+// 连续失败达到阈值，或半开状态下探测失败时打开熔断器
+func (b *CircuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+	b.save()
+}
+
+// State 返回熔断器当前状态：closed、open或half-open
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
@@ -0,0 +1,205 @@
+package internal
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 3 * time.Second, MaxDelay: 30 * time.Second}
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 3 * time.Second},
+		{2, 6 * time.Second},
+		{3, 12 * time.Second},
+		{4, 24 * time.Second},
+		{5, 30 * time.Second}, // 48秒超过上限
+		{10, 30 * time.Second},
+	}
+	for _, c := range cases {
+		if got := p.Backoff(c.attempt); got != c.want {
+			t.Errorf("第%d次失败后应等待%v，实际%v", c.attempt, c.want, got)
+		}
+	}
+}
+
+func TestRetryPolicyBackoffJitter(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 10 * time.Second, MaxDelay: 60 * time.Second, Jitter: 0.2}
+	for i := 0; i < 200; i++ {
+		got := p.Backoff(2) // 无抖动时为20秒
+		if got < 16*time.Second || got > 24*time.Second {
+			t.Fatalf("抖动后的等待时间应在16s到24s之间，实际%v", got)
+		}
+	}
+}
+
+func TestRetryPolicyFor(t *testing.T) {
+	cases := []struct {
+		name     string
+		cfg      *Config
+		endpoint string
+		want     RetryPolicy
+	}{
+		{"nil配置使用默认值", nil, EndpointData,
+			RetryPolicy{MaxAttempts: 3, BaseDelay: 3 * time.Second, MaxDelay: 30 * time.Second, Jitter: 0.2}},
+		{"只覆盖部分字段", &Config{Retry: map[string]RetryConfig{EndpointPrice: {MaxAttempts: 5}}}, EndpointPrice,
+			RetryPolicy{MaxAttempts: 5, BaseDelay: 3 * time.Second, MaxDelay: 15 * time.Second, Jitter: 0.2}},
+		{"未知接口至少尝试一次", &Config{}, "unknown",
+			RetryPolicy{MaxAttempts: 1}},
+		{"回放时不等待", &Config{Capture: CaptureConfig{Mode: CaptureReplay}}, EndpointData,
+			RetryPolicy{MaxAttempts: 3, NoWait: true}},
+	}
+	for _, c := range cases {
+		if got := c.cfg.RetryPolicyFor(c.endpoint); got != c.want {
+			t.Errorf("%s: 期望%+v，实际%+v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	header := func(value string) *http.Response {
+		resp := &http.Response{Header: make(http.Header)}
+		if value != "" {
+			resp.Header.Set("Retry-After", value)
+		}
+		return resp
+	}
+	cases := []struct {
+		name   string
+		resp   *http.Response
+		want   time.Duration
+		wantOK bool
+	}{
+		{"没有响应", nil, 0, false},
+		{"没有Retry-After", header(""), 0, false},
+		{"秒数", header("120"), 120 * time.Second, true},
+		{"零秒", header("0"), 0, true},
+		{"负数无效", header("-5"), 0, false},
+		{"无法识别", header("soon"), 0, false},
+		{"已过去的HTTP日期", header(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)), 0, true},
+	}
+	for _, c := range cases {
+		got, ok := retryAfter(c.resp)
+		if got != c.want || ok != c.wantOK {
+			t.Errorf("%s: 期望(%v, %v)，实际(%v, %v)", c.name, c.want, c.wantOK, got, ok)
+		}
+	}
+
+	// 将来的HTTP日期按距离现在的时长计算，HTTP日期只精确到秒
+	got, ok := retryAfter(header(time.Now().Add(90 * time.Second).UTC().Format(http.TimeFormat)))
+	if !ok || got < 88*time.Second || got > 90*time.Second {
+		t.Errorf("将来的HTTP日期应等待约90秒，实际(%v, %v)", got, ok)
+	}
+}
+
+func TestRetryPolicyWaitHonorsRetryAfter(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"60"}}}
+
+	// Retry-After比退避时间长时以它为准；ctx已取消，不会真的等待
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	delay, err := p.Wait(ctx, 1, resp)
+	if delay != 60*time.Second {
+		t.Errorf("应按Retry-After等待60秒，实际%v", delay)
+	}
+	if err == nil {
+		t.Error("ctx已取消时应返回错误")
+	}
+}
+
+func TestRetryPolicyWaitNoWait(t *testing.T) {
+	// 回放时即使有Retry-After也不等待
+	p := RetryPolicy{MaxAttempts: 3, NoWait: true}
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"60"}}}
+	delay, err := p.Wait(context.Background(), 1, resp)
+	if delay != 0 || err != nil {
+		t.Errorf("NoWait时应立即返回，实际(%v, %v)", delay, err)
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker(BreakerConfig{Threshold: 2, Cooldown: 60})
+
+	steps := []struct {
+		name string
+		do   func()
+		want string
+	}{
+		{"初始关闭", func() {}, BreakerClosed},
+		{"一次失败未达到阈值", b.RecordFailure, BreakerClosed},
+		{"成功清零失败计数", b.RecordSuccess, BreakerClosed},
+		{"再失败一次", b.RecordFailure, BreakerClosed},
+		{"连续两次失败后打开", b.RecordFailure, BreakerOpen},
+	}
+	for _, s := range steps {
+		s.do()
+		if got := b.State(); got != s.want {
+			t.Fatalf("%s: 期望%s，实际%s", s.name, s.want, got)
+		}
+	}
+	if b.Allow() {
+		t.Fatal("冷却期间不应放行")
+	}
+
+	// 冷却结束后只放行一个探测请求
+	b.openedAt = time.Now().Add(-2 * time.Minute)
+	if !b.Allow() {
+		t.Fatal("冷却结束后应放行探测请求")
+	}
+	if b.Allow() {
+		t.Fatal("探测请求有结果之前不应放行其他请求")
+	}
+	b.Abort()
+	if !b.Allow() {
+		t.Fatal("放弃探测后应重新放行一个请求")
+	}
+	b.RecordFailure()
+	if got := b.State(); got != BreakerOpen {
+		t.Fatalf("探测失败后应重新打开，实际%s", got)
+	}
+
+	b.openedAt = time.Now().Add(-2 * time.Minute)
+	if !b.Allow() {
+		t.Fatal("冷却结束后应放行探测请求")
+	}
+	b.RecordSuccess()
+	if got := b.State(); got != BreakerClosed || !b.Allow() || !b.Allow() {
+		t.Fatalf("探测成功后应关闭并放行所有请求，实际%s", got)
+	}
+}
+
+func TestCircuitBreakerPersisted(t *testing.T) {
+	path := t.TempDir() + "/price_breaker.json"
+	cfg := BreakerConfig{Threshold: 2, Cooldown: 60}
+
+	// 每次run都是新的进程，失败计数和打开状态应跨越多次运行
+	first := LoadCircuitBreaker(cfg, path)
+	first.RecordFailure()
+	second := LoadCircuitBreaker(cfg, path)
+	second.RecordFailure()
+	if got := second.State(); got != BreakerOpen {
+		t.Fatalf("两次运行各失败一次后应打开，实际%s", got)
+	}
+
+	third := LoadCircuitBreaker(cfg, path)
+	if third.State() != BreakerOpen || third.Allow() {
+		t.Fatal("冷却期间下一次运行也不应放行")
+	}
+
+	// 冷却结束后下一次运行放行一个探测请求，探测成功后关闭
+	third.openedAt = time.Now().Add(-2 * time.Minute)
+	third.save()
+	fourth := LoadCircuitBreaker(cfg, path)
+	if !fourth.Allow() {
+		t.Fatal("冷却结束后应放行探测请求")
+	}
+	fourth.RecordSuccess()
+	if got := LoadCircuitBreaker(cfg, path).State(); got != BreakerClosed {
+		t.Errorf("探测成功后保存的状态应为关闭，实际%s", got)
+	}
+}
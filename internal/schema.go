@@ -0,0 +1,305 @@
+// Package internal 包含项目的核心功能实现
+// 该文件负责宽松地解码上游响应，并记录字段结构的变化（schema drift）
+package internal
+
+import (
+	"bytes"         // 用于判断JSON值的类型
+	"context"       // 用于日志中的cycle_id
+	"encoding/json" // 用于JSON编解码
+	"errors"        // 用于定义错误
+	"fmt"           // 用于格式化输出
+	"os"            // 用于文件操作
+	"sort"          // 用于生成稳定的签名
+	"strconv"       // 用于类型转换
+	"strings"       // 用于字符串处理
+	"time"          // 用于时间处理
+)
+
+// schemaStateFile 最近一次结构检查结果，位于状态目录下
+const schemaStateFile = "schema_drift.json"
+
+// requiredAirdropFields 每个空投项目必须有的字段
+var requiredAirdropFields = []string{"token", "name", "date"}
+
+// SchemaReport 单次响应的结构检查结果
+// 各map的键为字段描述，值为出现该问题的项目数
+type SchemaReport struct {
+	CheckedAt       time.Time      `json:"checkedAt"`                 // 检查时间
+	Items           int            `json:"items"`                     // 项目总数
+	UnknownFields   map[string]int `json:"unknownFields,omitempty"`   // 未知字段，如"airdrops[].foo"
+	TypeMismatches  map[string]int `json:"typeMismatches,omitempty"`  // 类型不符，如"points: 期望string|number，实际object"
+	MissingRequired map[string]int `json:"missingRequired,omitempty"` // 缺失的必填字段
+}
+
+// newSchemaReport 创建空的检查结果
+func newSchemaReport() *SchemaReport {
+	return &SchemaReport{
+		CheckedAt:       time.Now(),
+		UnknownFields:   make(map[string]int),
+		TypeMismatches:  make(map[string]int),
+		MissingRequired: make(map[string]int),
+	}
+}
+
+// HasDrift 判断响应结构是否与代码预期不一致
+func (r *SchemaReport) HasDrift() bool {
+	return len(r.UnknownFields) > 0 || len(r.TypeMismatches) > 0 || len(r.MissingRequired) > 0
+}
+
+// Signature 返回结构问题的签名
+// 只包含问题种类而不含数量，项目数变化不会被当作新的结构变化
+func (r *SchemaReport) Signature() string {
+	var keys []string
+	for k := range r.UnknownFields {
+		keys = append(keys, "unknown:"+k)
+	}
+	for k := range r.TypeMismatches {
+		keys = append(keys, "type:"+k)
+	}
+	for k := range r.MissingRequired {
+		keys = append(keys, "missing:"+k)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// String 返回便于阅读的检查结果，用于日志和告警
+func (r *SchemaReport) String() string {
+	if !r.HasDrift() {
+		return "响应结构正常"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "共 %d 个项目\n", r.Items)
+	section := func(title string, m map[string]int) {
+		if len(m) == 0 {
+			return
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintf(&b, "\n%s:\n", title)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "- %s（%d个项目）\n", k, m[k])
+		}
+	}
+	section("未知字段", r.UnknownFields)
+	section("类型不符", r.TypeMismatches)
+	section("缺少必填字段", r.MissingRequired)
+	return b.String()
+}
+
+// jsonKind 返回JSON值的类型名称
+func jsonKind(raw json.RawMessage) string {
+	trimmed := bytes.TrimSpace(raw)
+	if len(trimmed) == 0 {
+		return "null"
+	}
+	switch trimmed[0] {
+	case '"':
+		return "string"
+	case '{':
+		return "object"
+	case '[':
+		return "array"
+	case 't', 'f':
+		return "bool"
+	case 'n':
+		return "null"
+	default:
+		return "number"
+	}
+}
+
+// decodeApiResponse 宽松地解码上游响应并检查其结构
+// 单个字段类型不符不会导致整个响应解析失败：能转换的（如数字形式的amount）会被转换，
+// 不能转换的保留零值，所有问题都记录在检查结果中
+// 参数:
+//   - body: 上游原始响应体
+// 返回:
+//   - *ApiResponse: 解析出的响应
+//   - *SchemaReport: 结构检查结果
+//   - error: 响应不是JSON对象或airdrops不是数组时返回错误
+func decodeApiResponse(body []byte) (*ApiResponse, *SchemaReport, error) {
+	report := newSchemaReport()
+
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(body, &top); err != nil {
+		return nil, report, err
+	}
+	for key := range top {
+		if key != "airdrops" {
+			report.UnknownFields[key]++
+		}
+	}
+
+	resp := &ApiResponse{}
+	rawList, ok := top["airdrops"]
+	if !ok {
+		report.MissingRequired["airdrops"]++
+		return resp, report, nil
+	}
+	if kind := jsonKind(rawList); kind != "array" {
+		report.TypeMismatches["airdrops: 期望array，实际"+kind]++
+		return nil, report, errors.New("airdrops字段不是数组")
+	}
+
+	var rawItems []map[string]json.RawMessage
+	if err := json.Unmarshal(rawList, &rawItems); err != nil {
+		return nil, report, fmt.Errorf("airdrops中存在非对象元素: %v", err)
+	}
+
+	report.Items = len(rawItems)
+	for _, fields := range rawItems {
+		resp.Airdrops = append(resp.Airdrops, decodeAirdrop(fields, report))
+	}
+	return resp, report, nil
+}
+
+// decodeAirdrop 按字段解码单个空投项目，并把问题记录到report
+func decodeAirdrop(fields map[string]json.RawMessage, report *SchemaReport) Airdrop {
+	var item Airdrop
+	stringFields := map[string]*string{
+		"token":            &item.Token,
+		"name":             &item.Name,
+		"date":             &item.Date,
+		"time":             &item.Time,
+		"amount":           &item.Amount,
+		"type":             &item.Type,
+		"status":           &item.Status,
+		"contract_address": &item.ContractAddress,
+		"chain_id":         &item.ChainID,
+	}
+
+	for key, raw := range fields {
+		kind := jsonKind(raw)
+		mismatch := func(expected string) {
+			report.TypeMismatches[fmt.Sprintf("%s: 期望%s，实际%s", key, expected, kind)]++
+		}
+
+		if target, ok := stringFields[key]; ok {
+			switch kind {
+			case "null":
+			case "string":
+				json.Unmarshal(raw, target)
+			case "number", "bool":
+				mismatch("string")
+				*target = string(bytes.TrimSpace(raw)) // 数字和布尔值按字面转换
+			default:
+				mismatch("string")
+			}
+			continue
+		}
+
+		switch key {
+		case "points":
+			switch kind {
+			case "string", "number":
+				json.Unmarshal(raw, &item.Points)
+			case "null":
+			default:
+				mismatch("string|number") // 对象或数组无法显示为积分，保留零值
+			}
+		case "phase":
+			item.Phase = int(decodeNumber(raw, kind, mismatch))
+		case "system_timestamp":
+			item.SystemTimestamp = decodeNumber(raw, kind, mismatch)
+		case "completed":
+			switch kind {
+			case "bool":
+				json.Unmarshal(raw, &item.Completed)
+			case "null":
+			default:
+				mismatch("bool")
+			}
+		default:
+			report.UnknownFields["airdrops[]."+key]++
+		}
+	}
+
+	for _, key := range requiredAirdropFields {
+		if raw, ok := fields[key]; !ok || jsonKind(raw) == "null" || *stringFields[key] == "" {
+			report.MissingRequired[key]++
+		}
+	}
+	return item
+}
+
+// decodeNumber 解码整数字段，数字形式的字符串会被转换并记为类型不符
+func decodeNumber(raw json.RawMessage, kind string, mismatch func(string)) int64 {
+	switch kind {
+	case "number":
+		var f float64
+		json.Unmarshal(raw, &f)
+		return int64(f)
+	case "null":
+		return 0
+	case "string":
+		mismatch("number")
+		var str string
+		json.Unmarshal(raw, &str)
+		n, _ := strconv.ParseInt(strings.TrimSpace(str), 10, 64)
+		return n
+	default:
+		mismatch("number")
+		return 0
+	}
+}
+
+// schemaState 保存在状态目录中的上一次检查结果
+type schemaState struct {
+	Signature string        `json:"signature"`
+	Report    *SchemaReport `json:"report"`
+}
+
+// loadSchemaState 读取上一次保存的检查结果，文件不存在或无法解析时为零值
+func (s *AirdropService) loadSchemaState() schemaState {
+	var last schemaState
+	if data, err := os.ReadFile(s.config.StatePath(schemaStateFile)); err == nil {
+		json.Unmarshal(data, &last)
+	}
+	return last
+}
+
+// newSchemaDrift 判断本周期的结构检查结果是否为需要告警的新变化，不写入状态文件
+// 只有存在问题且签名与上次保存的不同时才返回报告，避免同一变化每个周期都告警
+func (s *AirdropService) newSchemaDrift() *SchemaReport {
+	report := s.schemaReport
+	if report == nil || !report.HasDrift() || s.replaying() {
+		return nil
+	}
+	if report.Signature() == s.loadSchemaState().Signature {
+		return nil
+	}
+	return report
+}
+
+// RecordSchemaReport 保存本周期的结构检查结果，之后相同的结构不再告警
+// 结构出现新的变化时，应在告警发送成功后再调用，发送失败时下个周期会重新告警；
+// 没有获取到JSON接口响应、签名未变化或回放时不写入
+// 参数:
+//   - ctx: 上下文，用于日志中的cycle_id
+func (s *AirdropService) RecordSchemaReport(ctx context.Context) {
+	report := s.schemaReport
+	if report == nil || s.replaying() {
+		return
+	}
+	signature := report.Signature()
+	if signature == s.loadSchemaState().Signature {
+		return
+	}
+
+	path := s.config.StatePath(schemaStateFile)
+	data, err := json.MarshalIndent(schemaState{Signature: signature, Report: report}, "", "  ")
+	if err == nil {
+		err = os.WriteFile(path, data, 0644)
+	}
+	if err != nil {
+		Logger(ctx).Error("保存结构检查结果失败", LogKeyPath, path, LogKeyError, err)
+		return
+	}
+	if !report.HasDrift() {
+		Logger(ctx).Info("上游响应结构已恢复正常")
+	}
+}
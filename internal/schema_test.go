@@ -0,0 +1,123 @@
+package internal
+
+import "testing"
+
+func TestDecodeApiResponse(t *testing.T) {
+	cases := []struct {
+		name    string
+		body    string
+		want    Airdrop // 第一个空投
+		sig     string  // 结构问题的签名
+		wantErr bool
+	}{
+		{
+			name: "结构正常",
+			body: `{"airdrops": [{"token": "ABC", "name": "Alpha", "date": "2025-09-10", "time": "18:00", "points": "200", "amount": "1,000", "phase": 2, "completed": true}]}`,
+			want: Airdrop{Token: "ABC", Name: "Alpha", Date: "2025-09-10", Time: "18:00", Points: "200", Amount: "1,000", Phase: 2, Completed: true},
+		},
+		{
+			name: "未知字段",
+			body: `{"airdrops": [{"token": "ABC", "name": "Alpha", "date": "2025-09-10", "foo": 1}], "meta": {}}`,
+			want: Airdrop{Token: "ABC", Name: "Alpha", Date: "2025-09-10"},
+			sig:  "unknown:airdrops[].foo,unknown:meta",
+		},
+		{
+			name: "数字形式的amount按字面转换",
+			body: `{"airdrops": [{"token": "ABC", "name": "Alpha", "date": "2025-09-10", "amount": 1500}]}`,
+			want: Airdrop{Token: "ABC", Name: "Alpha", Date: "2025-09-10", Amount: "1500"},
+			sig:  "type:amount: 期望string，实际number",
+		},
+		{
+			name: "字符串形式的phase",
+			body: `{"airdrops": [{"token": "ABC", "name": "Alpha", "date": "2025-09-10", "phase": "3"}]}`,
+			want: Airdrop{Token: "ABC", Name: "Alpha", Date: "2025-09-10", Phase: 3},
+			sig:  "type:phase: 期望number，实际string",
+		},
+		{
+			name: "points变为对象时保留零值",
+			body: `{"airdrops": [{"token": "ABC", "name": "Alpha", "date": "2025-09-10", "points": {"min": 200}}]}`,
+			want: Airdrop{Token: "ABC", Name: "Alpha", Date: "2025-09-10"},
+			sig:  "type:points: 期望string|number，实际object",
+		},
+		{
+			name: "date改名后缺少必填字段",
+			body: `{"airdrops": [{"token": "ABC", "name": "Alpha", "day": "2025-09-10"}]}`,
+			want: Airdrop{Token: "ABC", Name: "Alpha"},
+			sig:  "missing:date,unknown:airdrops[].day",
+		},
+		{
+			name: "null按缺失处理",
+			body: `{"airdrops": [{"token": "ABC", "name": null, "date": "2025-09-10", "completed": null}]}`,
+			want: Airdrop{Token: "ABC", Date: "2025-09-10"},
+			sig:  "missing:name",
+		},
+		{
+			name: "没有airdrops字段",
+			body: `{"data": []}`,
+			sig:  "missing:airdrops,unknown:data",
+		},
+		{name: "airdrops不是数组", body: `{"airdrops": {}}`, wantErr: true},
+		{name: "元素不是对象", body: `{"airdrops": [1]}`, wantErr: true},
+		{name: "不是JSON", body: `<html>`, wantErr: true},
+	}
+	for _, c := range cases {
+		resp, report, err := decodeApiResponse([]byte(c.body))
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: 期望错误%v，实际%v", c.name, c.wantErr, err)
+			continue
+		}
+		if c.wantErr {
+			continue
+		}
+		if got := report.Signature(); got != c.sig {
+			t.Errorf("%s: 期望签名%q，实际%q", c.name, c.sig, got)
+		}
+		if report.HasDrift() != (c.sig != "") {
+			t.Errorf("%s: HasDrift与签名不一致", c.name)
+		}
+		if len(resp.Airdrops) == 0 {
+			if c.want.Token != "" {
+				t.Errorf("%s: 没有解析出空投", c.name)
+			}
+			continue
+		}
+		got := resp.Airdrops[0]
+		if got.Token != c.want.Token || got.Name != c.want.Name || got.Date != c.want.Date || got.Time != c.want.Time ||
+			got.Amount != c.want.Amount || got.Phase != c.want.Phase || got.Completed != c.want.Completed ||
+			pointsString(got.Points) != pointsString(c.want.Points) {
+			t.Errorf("%s: 期望%+v，实际%+v", c.name, c.want, got)
+		}
+	}
+}
+
+func TestSchemaSignatureStable(t *testing.T) {
+	// 同样的结构问题，项目顺序、字段顺序和出现次数不同时签名应相同，否则会重复告警
+	bodies := []string{
+		`{"airdrops": [
+			{"token": "A", "name": "a", "date": "2025-09-10", "amount": 1, "foo": true},
+			{"token": "B", "name": "b", "date": "2025-09-11"}
+		]}`,
+		`{"airdrops": [
+			{"token": "B", "name": "b", "date": "2025-09-11", "foo": false},
+			{"foo": 0, "amount": 2, "date": "2025-09-10", "name": "a", "token": "A"},
+			{"token": "C", "name": "c", "date": "2025-09-12", "amount": 3, "foo": 1}
+		]}`,
+	}
+	var signatures []string
+	for _, body := range bodies {
+		_, report, err := decodeApiResponse([]byte(body))
+		if err != nil {
+			t.Fatalf("解析失败: %v", err)
+		}
+		signatures = append(signatures, report.Signature())
+	}
+	if signatures[0] != signatures[1] {
+		t.Errorf("签名应与顺序和数量无关: %q != %q", signatures[0], signatures[1])
+	}
+
+	// 新出现的问题应改变签名
+	_, report, _ := decodeApiResponse([]byte(`{"airdrops": [{"token": "A", "name": "a", "date": "2025-09-10", "amount": 1, "foo": true, "bar": 1}]}`))
+	if report.Signature() == signatures[0] {
+		t.Error("出现新的未知字段时签名应变化")
+	}
+}
@@ -0,0 +1,299 @@
+// Package internal 包含项目的核心功能实现
+// 该文件负责敏感信息的加载与脱敏：SendKey、Cookie等可以从环境变量或文件读取，
+// 所有日志输出、错误信息和录制文件在写出前都会经过统一的脱敏处理
+package internal
+
+import (
+	"bufio"   // 用于按行转发标准输出
+	"errors"  // 用于包装脱敏后的错误
+	"fmt"     // 用于格式化输出
+	"io"      // 用于实现脱敏Writer
+	"log"     // 用于替换标准日志的输出
+	"os"      // 用于读取环境变量和文件
+	"regexp"  // 用于匹配常见的敏感字段
+	"sort"    // 用于优先替换较长的敏感值
+	"strings" // 用于字符串处理
+	"sync"    // 用于保护已登记的敏感值
+)
+
+// redactedMask 完全隐藏的敏感值的替代文本
+const redactedMask = "[REDACTED]"
+
+// minSecretLength 登记的敏感值的最短长度，过短的值替换时容易误伤普通文本
+const minSecretLength = 6
+
+// 敏感信息的环境变量，X_FILE形式的变量表示从该文件读取
+const (
+	EnvSendKeys  = "SENDKEYS"   // 逗号或换行分隔的SendKey
+	EnvAlertKeys = "ALERT_KEYS" // 逗号或换行分隔的告警SendKey
+	EnvCookie    = "CF_COOKIE"  // 请求上游使用的CloudFlare Cookie
+)
+
+// secretPatterns 不需要登记也会被脱敏的常见格式
+// 每个表达式的第一个分组是需要保留的前缀，其余部分替换为redactedMask
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(SCT\d*)[A-Za-z0-9]{8,}`),                                            // Server酱SendKey
+	regexp.MustCompile(`(sctp\d+t)[A-Za-z0-9]{8,}`),                                          // Server酱3 SendKey
+	regexp.MustCompile(`(?i)((?:cf_clearance|__cf_bm|_clck|_clsk)=)[^;\s"'&]+`),              // CloudFlare及统计Cookie
+	regexp.MustCompile(`(?i)((?:cookie|authorization):\s*)[^\r\n"]+`),                        // 请求头形式的Cookie和认证信息
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`),                                 // Bearer令牌
+	regexp.MustCompile(`(?i)([?&](?:sendkey|key|token|secret|access_token|sign)=)[^&\s"']+`), // URL中的密钥参数
+}
+
+// Redactor 记录已知的敏感值，并把文本中出现的敏感值替换掉
+type Redactor struct {
+	mu      sync.RWMutex
+	secrets []string // 按长度从长到短排列，避免短值先替换破坏长值
+}
+
+// defaultRedactor 进程内共享的脱敏器
+var defaultRedactor = &Redactor{}
+
+// Register 登记需要脱敏的值，空值和过短的值会被忽略
+func (r *Redactor) Register(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if len(v) < minSecretLength {
+			continue
+		}
+		known := false
+		for _, s := range r.secrets {
+			if s == v {
+				known = true
+				break
+			}
+		}
+		if !known {
+			r.secrets = append(r.secrets, v)
+		}
+	}
+	sort.Slice(r.secrets, func(i, j int) bool { return len(r.secrets[i]) > len(r.secrets[j]) })
+}
+
+// Redact 返回脱敏后的文本
+// 先替换已登记的值（保留前4个字符便于区分是哪个密钥），再按常见格式兜底
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	for _, secret := range r.secrets {
+		if strings.Contains(s, secret) {
+			s = strings.ReplaceAll(s, secret, maskSecret(secret))
+		}
+	}
+	r.mu.RUnlock()
+	for _, pattern := range secretPatterns {
+		s = pattern.ReplaceAllString(s, "${1}"+redactedMask)
+	}
+	return s
+}
+
+// maskSecret 保留敏感值的前4个字符，其余部分隐藏
+func maskSecret(v string) string {
+	if len(v) <= 8 {
+		return redactedMask
+	}
+	return v[:4] + redactedMask
+}
+
+// RegisterSecret 向全局脱敏器登记敏感值
+// 参数:
+//   - values: 需要在日志、错误和录制文件中隐藏的值
+func RegisterSecret(values ...string) {
+	defaultRedactor.Register(values...)
+}
+
+// Redact 使用全局脱敏器处理文本
+// 参数:
+//   - s: 待输出的文本
+// 返回:
+//   - string: 脱敏后的文本
+func Redact(s string) string {
+	return defaultRedactor.Redact(s)
+}
+
+// RedactError 返回错误信息已脱敏的错误，nil原样返回
+// 参数:
+//   - err: 原始错误，可能来自第三方SDK并包含请求地址或密钥
+// 返回:
+//   - error: 脱敏后的错误
+func RedactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := Redact(err.Error())
+	if msg == err.Error() {
+		return err // 没有敏感信息时保留原错误，errors.Is仍然可用
+	}
+	return errors.New(msg)
+}
+
+// registerCookie 登记Cookie整体以及其中每个值
+func registerCookie(cookie string) {
+	RegisterSecret(cookie)
+	for _, part := range strings.Split(cookie, ";") {
+		if _, value, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			RegisterSecret(value)
+		}
+	}
+}
+
+// RedactingWriter 按行脱敏后再写入下层Writer的io.Writer
+// 按行缓冲可以避免一个密钥被拆在两次Write中而漏掉
+type RedactingWriter struct {
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+// NewRedactingWriter 创建脱敏Writer
+// 参数:
+//   - w: 实际输出的Writer
+// 返回:
+//   - *RedactingWriter: 脱敏Writer实例
+func NewRedactingWriter(w io.Writer) *RedactingWriter {
+	return &RedactingWriter{w: w}
+}
+
+// Write 缓冲输入，遇到换行时输出脱敏后的整行
+func (rw *RedactingWriter) Write(p []byte) (int, error) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.buf = append(rw.buf, p...)
+	for {
+		i := strings.IndexByte(string(rw.buf), '\n')
+		if i < 0 {
+			break
+		}
+		line := string(rw.buf[:i+1])
+		rw.buf = rw.buf[i+1:]
+		if _, err := io.WriteString(rw.w, Redact(line)); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush 输出缓冲中不以换行结尾的剩余内容
+func (rw *RedactingWriter) Flush() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if len(rw.buf) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(rw.w, Redact(string(rw.buf)))
+	rw.buf = nil
+	return err
+}
+
+// InstallRedaction 让标准日志和标准输出都经过脱敏
+// 标准输出替换为管道，由后台goroutine脱敏后写回原来的终端，
+// 因此fmt.Printf和第三方SDK的打印也会被处理
+// 返回:
+//   - func(): 恢复原始输出并等待缓冲内容写完，程序退出前调用
+func InstallRedaction() func() {
+	stderr := NewRedactingWriter(os.Stderr)
+	log.SetOutput(stderr)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无法拦截标准输出，只对日志脱敏: %v\n", err)
+		return func() { stderr.Flush() }
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		out := NewRedactingWriter(stdout)
+		reader := bufio.NewReader(r)
+		for {
+			chunk, err := reader.ReadString('\n')
+			out.Write([]byte(chunk))
+			if err != nil {
+				out.Flush()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		os.Stdout = stdout
+		w.Close()
+		<-done
+		r.Close()
+		stderr.Flush()
+	}
+}
+
+// readSecret 按环境变量、环境变量指定的文件、配置中的文件的顺序读取敏感值
+// 参数:
+//   - env: 环境变量名，同时检查env+"_FILE"
+//   - file: 配置中指定的文件路径，可为空
+// 返回:
+//   - string: 读取到的值，去掉首尾空白
+//   - bool: 是否从上述任一位置读取到
+//   - error: 文件读取失败时返回错误
+func readSecret(env, file string) (string, bool, error) {
+	if v, ok := os.LookupEnv(env); ok && strings.TrimSpace(v) != "" {
+		return strings.TrimSpace(v), true, nil
+	}
+	if path := os.Getenv(env + "_FILE"); path != "" {
+		file = path
+	}
+	if file == "" {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return "", false, fmt.Errorf("读取 %s 的密钥文件失败: %v", env, err)
+	}
+	return strings.TrimSpace(string(data)), true, nil
+}
+
+// splitKeys 把逗号、换行或空白分隔的密钥列表拆开
+func splitKeys(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r' || r == ' ' || r == '\t'
+	})
+}
+
+// loadSecrets 从环境变量或文件加载敏感配置，覆盖config.json中的值，并登记到脱敏器
+// 返回:
+//   - error: 指定的密钥文件读取失败时返回错误
+func (c *Config) loadSecrets() error {
+	if v, ok, err := readSecret(EnvSendKeys, c.SendKeysFile); err != nil {
+		return err
+	} else if ok {
+		c.SendKeys = recipientsFromKeys(splitKeys(v), c.SendKeys)
+	}
+	if v, ok, err := readSecret(EnvAlertKeys, c.AlertKeysFile); err != nil {
+		return err
+	} else if ok {
+		c.AlertKeys = splitKeys(v)
+	}
+	if v, ok, err := readSecret(EnvCookie, c.CookieFile); err != nil {
+		return err
+	} else if ok {
+		c.cookie = v
+	}
+
+	RegisterSecret(c.sendKeyList()...)
+	RegisterSecret(c.AlertKeys...)
+	registerCookie(c.cookie)
+	return nil
+}
+
+// UpstreamCookie 返回请求上游时使用的Cookie
+// 配置加载失败（c为nil）时直接读取CF_COOKIE环境变量
+// 返回:
+//   - string: Cookie，未配置时为空字符串
+func (c *Config) UpstreamCookie() string {
+	if c == nil {
+		cookie := os.Getenv(EnvCookie)
+		registerCookie(cookie)
+		return cookie
+	}
+	return c.cookie
+}
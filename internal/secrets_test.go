@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactPatterns(t *testing.T) {
+	r := &Redactor{}
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"Server酱SendKey", "key=SCT123456abcdefghXYZ end", "key=SCT123456[REDACTED] end"},
+		{"Server酱3 SendKey", "sctp1234tAbCdEfGh12 sent", "sctp1234t[REDACTED] sent"},
+		{"cf_clearance", "cf_clearance=abc.def-123; path=/", "cf_clearance=[REDACTED]; path=/"},
+		{"__cf_bm不区分大小写", "__CF_BM=xyz123", "__CF_BM=[REDACTED]"},
+		{"Cookie请求头", "Cookie: a=1; b=2", "Cookie: [REDACTED]"},
+		{"Authorization请求头", "authorization: Basic dXNlcjpwYXNz\n", "authorization: [REDACTED]\n"},
+		{"Bearer令牌", "token is Bearer eyJhbGciOi.x_y-z", "token is Bearer [REDACTED]"},
+		{"URL中的sendkey", "https://sctapi.ftqq.com/send?sendkey=abcdef&title=x", "https://sctapi.ftqq.com/send?sendkey=[REDACTED]&title=x"},
+		{"URL中的token", "/api?a=1&token=secret123", "/api?a=1&token=[REDACTED]"},
+		{"普通文本不变", "已推送 3 条消息，SCT短", "已推送 3 条消息，SCT短"},
+	}
+	for _, c := range cases {
+		if got := r.Redact(c.in); got != c.want {
+			t.Errorf("%s: 期望%q，实际%q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestRedactorRegister(t *testing.T) {
+	r := &Redactor{}
+	r.Register("abc", "   ", "short12", "longsecretvalue", "longsecretvalue-extended")
+
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"过短的值不登记", "abc", "abc"},
+		{"不超过8个字符时完全隐藏", "x short12 y", "x [REDACTED] y"},
+		{"保留前4个字符", "v=longsecretvalue", "v=long[REDACTED]"},
+		{"先替换较长的值", "longsecretvalue-extended", "long[REDACTED]"},
+	}
+	for _, c := range cases {
+		if got := r.Redact(c.in); got != c.want {
+			t.Errorf("%s: 期望%q，实际%q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	plain := errors.New("连接超时")
+	if got := RedactError(plain); got != plain {
+		t.Error("没有敏感信息时应返回原错误")
+	}
+	err := RedactError(fmt.Errorf("请求失败: https://sctapi.ftqq.com/SCT99secretvalue1234.send"))
+	if strings.Contains(err.Error(), "secretvalue1234") {
+		t.Errorf("错误信息中的SendKey应被隐藏: %v", err)
+	}
+	if RedactError(nil) != nil {
+		t.Error("nil应原样返回")
+	}
+}
+
+func TestRedactingWriter(t *testing.T) {
+	RegisterSecret("writer-secret-0123456789")
+
+	cases := []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"整行写入", []string{"key writer-secret-0123456789\n"}, "key writ[REDACTED]\n"},
+		{"登记的值拆在两次写入中", []string{"key writer-secr", "et-0123456789\n"}, "key writ[REDACTED]\n"},
+		{"格式匹配的值拆在两次写入中", []string{"Cookie: cf_clear", "ance=abc123\n"}, "Cookie: [REDACTED]\n"},
+		{"多行", []string{"a\nSCT1abcdefghij\nb"}, "a\nSCT1[REDACTED]\nb"},
+		{"没有换行的结尾由Flush输出", []string{"tail writer-secret-0123456789"}, "tail writ[REDACTED]"},
+	}
+	for _, c := range cases {
+		var out bytes.Buffer
+		w := NewRedactingWriter(&out)
+		for _, s := range c.writes {
+			if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+				t.Fatalf("%s: Write返回(%d, %v)", c.name, n, err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("%s: Flush失败: %v", c.name, err)
+		}
+		if got := out.String(); got != c.want {
+			t.Errorf("%s: 期望%q，实际%q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestInstallRedaction(t *testing.T) {
+	RegisterSecret("stdout-secret-0123456789")
+
+	out, err := os.CreateTemp(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	original := os.Stdout
+	os.Stdout = out
+	restore := InstallRedaction()
+	fmt.Println("sendkey stdout-secret-0123456789")
+	fmt.Print("partial stdout-secret-") // 拆成两次打印
+	fmt.Print("0123456789 done")
+	restore()
+	os.Stdout = original
+	log.SetOutput(os.Stderr)
+
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if strings.Contains(got, "secret-0123456789") {
+		t.Errorf("标准输出中的密钥应被隐藏: %q", got)
+	}
+	if want := "sendkey stdo[REDACTED]\npartial stdo[REDACTED] done"; got != want {
+		t.Errorf("期望%q，实际%q", want, got)
+	}
+}
+
+// stubTransport 返回固定响应的Transport
+type stubTransport struct {
+	resp *http.Response
+}
+
+// RoundTrip 返回固定的响应
+func (s stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	s.resp.Request = req
+	return s.resp, nil
+}
+
+func TestRecordingTransportRedacts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	resp := &http.Response{
+		StatusCode: 200,
+		Header: http.Header{
+			"Set-Cookie":   []string{"__cf_bm=server-cookie-value; path=/"},
+			"Content-Type": []string{"application/json"},
+		},
+		Body: io.NopCloser(strings.NewReader(`{"echo": "cf_clearance=body-cookie-value", "key": "SCT42bodysendkey99"}`)),
+	}
+	transport := NewRecordingTransport(stubTransport{resp: resp}, path)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com/api/data?sendkey=url-secret-value&t=1", nil)
+	req.Header.Set("Cookie", "cf_clearance=request-cookie-value")
+	req.Header.Set("Authorization", "Bearer auth-token-value")
+	req.Header.Set("User-Agent", "test")
+	got, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	body, _ := io.ReadAll(got.Body)
+	if !strings.Contains(string(body), "body-cookie-value") {
+		t.Error("返回给调用方的响应体不应被脱敏")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("打开录制文件失败: %v", err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		t.Fatal("录制文件为空")
+	}
+	line := scanner.Text()
+	for _, secret := range []string{"server-cookie-value", "body-cookie-value", "bodysendkey99", "url-secret-value", "request-cookie-value", "auth-token-value"} {
+		if strings.Contains(line, secret) {
+			t.Errorf("录制文件中不应出现%q: %s", secret, line)
+		}
+	}
+
+	var entry CaptureEntry
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatalf("解析录制失败: %v", err)
+	}
+	cases := []struct {
+		name, got, want string
+	}{
+		{"Cookie请求头", entry.RequestHeaders["Cookie"], redactedMask},
+		{"Authorization请求头", entry.RequestHeaders["Authorization"], redactedMask},
+		{"普通请求头保留", entry.RequestHeaders["User-Agent"], "test"},
+		{"Set-Cookie响应头", entry.ResponseHeaders["Set-Cookie"], redactedMask},
+		{"URL", entry.URL, "https://example.com/api/data?sendkey=[REDACTED]&t=1"},
+	}
+	for _, c := range cases {
+		if c.got != c.want {
+			t.Errorf("%s: 期望%q，实际%q", c.name, c.want, c.got)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Package internal 包含项目的核心功能实现
+// 该文件实现可选的本地HTTP服务，提供Prometheus指标、健康检查、只读JSON接口和内置看板
+package internal
+
+import (
+	"context"  // 用于在程序退出时关闭服务
+	"log/slog" // 用于结构化日志
+	"net"      // 用于监听端口
+	"net/http" // 用于HTTP服务
+	"time"     // 用于超时设置
+)
+
+// ServerConfig 本地HTTP服务配置
+type ServerConfig struct {
+	Listen string `json:"listen"` // 监听地址，如"127.0.0.1:9100"，为空表示不启动
+}
+
+// NewServeMux 创建本地HTTP服务的路由
+// 参数:
+//   - config: 配置信息
+//   - service: daemon使用的空投服务
+// 返回:
+//   - *http.ServeMux: 包含/metrics、/healthz、/readyz、/api/、/calendar.ics、/feed.atom、/feed.rss和看板页面的路由
+func NewServeMux(config *Config, service *AirdropService) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+
+	checker := NewHealthChecker(config, service)
+	mux.HandleFunc("/healthz", checker.LiveHandler)
+	mux.HandleFunc("/readyz", checker.ReadyHandler)
+
+	NewAPI(config, service).Register(mux)
+	mux.HandleFunc("/calendar.ics", CalendarHandler(config, service))
+	mux.HandleFunc("/feed.atom", FeedHandler(config, false))
+	mux.HandleFunc("/feed.rss", FeedHandler(config, true))
+	NewDashboard(config, service).Register(mux)
+	return mux
+}
+
+// StartServer 在后台启动本地HTTP服务，ctx取消时关闭
+// 参数:
+//   - ctx: 控制服务生命周期的上下文
+//   - cfg: 服务配置，Listen为空时不启动
+//   - handler: 请求处理器，通常为NewServeMux的返回值
+// 返回:
+//   - error: 端口监听失败时返回错误
+func StartServer(ctx context.Context, cfg ServerConfig, handler http.Handler) error {
+	if cfg.Listen == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("本地HTTP服务异常退出", LogKeyError, err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("本地HTTP服务已启动", "listen", ln.Addr().String())
+	return nil
+}
@@ -0,0 +1,150 @@
+// Package internal 包含项目的核心功能实现
+// 该文件定义空投数据来源接口，并在主接口不可用时按顺序回退到备用来源
+package internal
+
+import (
+	"context" // 用于取消和超时控制
+	"errors"  // 用于定义错误
+	"fmt"     // 用于格式化输出
+	"os"      // 用于读取手工数据文件
+	"strings" // 用于字符串处理
+)
+
+// 数据来源名称，用于日志和DataStatus.Source
+const (
+	SourceAPI    = "api"    // JSON接口 /api/data
+	SourceHTML   = "html"   // 公开页面 zh/index.html
+	SourceCache  = "cache"  // 最近一次成功响应的缓存
+	SourceManual = "manual" // 本地手工维护的空投文件
+)
+
+// defaultManualFile manual来源的默认文件名，位于状态目录下
+const defaultManualFile = "manual_airdrops.json"
+
+// AirdropSource 空投数据来源
+// 不同来源解析出的数据统一为ApiResponse，后续的过滤、快照和消息生成不区分来源
+type AirdropSource interface {
+	// Name 返回来源名称
+	Name() string
+	// Fetch 获取空投列表，失败时返回错误
+	Fetch(ctx context.Context) (*ApiResponse, error)
+}
+
+// apiSource 基于JSON接口的来源，重试、结构检查、隔离和缓存都在GetAirdropData中完成
+type apiSource struct {
+	service *AirdropService
+}
+
+// Name 返回来源名称
+func (a *apiSource) Name() string {
+	return SourceAPI
+}
+
+// Fetch 通过GetAirdropData获取空投列表，结构检查结果留给本周期的DataStatus使用
+func (a *apiSource) Fetch(ctx context.Context) (*ApiResponse, error) {
+	resp, report := a.service.GetAirdropData(ctx)
+	a.service.schemaReport = report
+	if resp == nil {
+		return nil, errors.New("JSON接口不可用")
+	}
+	return resp, nil
+}
+
+// FileSource 读取本地JSON文件的数据来源，文件格式与/api/data的响应相同
+type FileSource struct {
+	path string
+}
+
+// NewFileSource 创建本地文件来源
+// 参数:
+//   - path: JSON文件路径
+// 返回:
+//   - *FileSource: 本地文件来源实例
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+// Name 返回来源名称
+func (f *FileSource) Name() string {
+	return SourceManual
+}
+
+// Fetch 读取文件中的空投列表，文件不存在时视为没有手工数据
+func (f *FileSource) Fetch(ctx context.Context) (*ApiResponse, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &ApiResponse{}, nil
+		}
+		return nil, err
+	}
+	resp, report, err := decodeApiResponse(data)
+	if err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", f.path, err)
+	}
+	if report.HasDrift() {
+		Logger(ctx).Warn("手工数据文件的字段与预期不符", LogKeySource, SourceManual, LogKeyPath, f.path, "drift", report.Signature())
+	}
+	return resp, nil
+}
+
+// sourceByName 按名称创建数据来源，未知名称返回nil
+func (s *AirdropService) sourceByName(name string) AirdropSource {
+	switch name {
+	case SourceAPI:
+		return &apiSource{service: s}
+	case SourceHTML:
+		return NewHTMLSource(s.config, s.transport)
+	case SourceManual:
+		path := s.config.Merge.ManualFile
+		if path == "" {
+			path = s.config.StatePath(defaultManualFile)
+		}
+		return NewFileSource(path)
+	}
+	return nil
+}
+
+// sources 返回按优先级排列的数据来源
+// JSON接口总是排在第一位，备用来源只在前面的来源失败时使用
+func (s *AirdropService) sources() []AirdropSource {
+	sources := []AirdropSource{&apiSource{service: s}}
+	if s.config != nil && s.config.HTMLSource.Enabled {
+		sources = append(sources, NewHTMLSource(s.config, s.transport))
+	}
+	return sources
+}
+
+// fetchAirdrops 依次尝试各个数据来源，返回第一个成功的结果
+// 备用来源的结果同样要经过合理性检查，避免把被拦截页面解析出的空列表当作真实数据
+// 参数:
+//   - ctx: 控制取消的上下文
+// 返回:
+//   - *ApiResponse: 空投数据，所有来源都失败时返回nil
+//   - string: 提供数据的来源名称
+func (s *AirdropService) fetchAirdrops(ctx context.Context) (*ApiResponse, string) {
+	// 配置了merge.sources时同时获取并合并所有来源
+	if s.config != nil && len(s.config.Merge.Sources) > 0 {
+		return s.fetchMerged(ctx)
+	}
+
+	for _, source := range s.sources() {
+		if ctx.Err() != nil {
+			return nil, ""
+		}
+		resp, err := source.Fetch(ctx)
+		if err != nil {
+			Logger(ctx).Warn("数据来源获取失败", LogKeySource, source.Name(), LogKeyError, err)
+			continue
+		}
+		if source.Name() != SourceAPI {
+			if issues := s.checkResponseSanity(ctx, resp); len(issues) > 0 {
+				Logger(ctx).Warn("数据来源的结果可疑，已忽略", LogKeySource, source.Name(), "reasons", strings.Join(issueReasons(issues), "; "))
+				continue
+			}
+			Logger(ctx).Info("已使用备用数据来源", LogKeySource, source.Name(), LogKeyCount, len(resp.Airdrops))
+		}
+		return resp, source.Name()
+	}
+	return nil, ""
+}
@@ -0,0 +1,330 @@
+// Package internal 包含项目的核心功能实现
+// 该文件基于历史归档生成空投统计：数量、TGE占比、估值、积分门槛、每分价值最高的空投，
+// 以及每个接收人按其积分能领取的总估值；可以每周推送一次
+package internal
+
+import (
+	"context"       // 用于取消推送
+	"encoding/json" // 用于周报记录的编解码
+	"fmt"           // 用于格式化
+	"os"            // 用于读写周报记录
+	"sort"          // 用于排序
+	"strings"       // 用于解析星期
+	"time"          // 用于日期计算
+)
+
+// weeklyReportFile 周报发送记录文件名，位于状态目录下
+const weeklyReportFile = "weekly_report.json"
+
+// defaultReportHour 未配置stats.hour时周报的推送时间
+const defaultReportHour = 9
+
+// statsTopN 统计中列出的每分价值最高的空投数量
+const statsTopN = 5
+
+// StatsConfig 统计周报配置
+type StatsConfig struct {
+	Weekly  bool   `json:"weekly"`  // 是否每周推送一次统计
+	Weekday string `json:"weekday"` // 推送的星期，如"monday"，默认monday
+	Hour    *int   `json:"hour"`    // 推送的小时（0-23），按timezone解释，默认9
+}
+
+// weekday 返回推送的星期，无法识别时为星期一
+func (c StatsConfig) weekday() time.Weekday {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(c.Weekday, d.String()) {
+			return d
+		}
+	}
+	return time.Monday
+}
+
+// hour 返回推送的小时
+func (c StatsConfig) hour() int {
+	if c.Hour == nil {
+		return defaultReportHour
+	}
+	return *c.Hour
+}
+
+// StatsItem 统计中的一个空投
+type StatsItem struct {
+	Token         string  `json:"token"`         // 代币符号
+	Name          string  `json:"name"`          // 项目名称
+	Date          string  `json:"date"`          // 空投日期
+	Phase         int     `json:"phase"`         // 空投阶段
+	Points        int     `json:"points"`        // 所需积分
+	Value         float64 `json:"value"`         // 按最后价格的估值（USD）
+	ValuePerPoint float64 `json:"valuePerPoint"` // 每分价值
+}
+
+// RecipientTotal 一个接收人按其积分能领取的空投
+type RecipientTotal struct {
+	Recipient string  `json:"recipient"` // 积分账本成员名，或SendKey的脱敏标识
+	SendKey   string  `json:"-"`         // 用于单独推送
+	Eligible  int     `json:"eligible"`  // 达到门槛的空投数量
+	Value     float64 `json:"value"`     // 达到门槛的空投总估值（USD）
+}
+
+// Stats 一段时间内空投的统计
+type Stats struct {
+	From        string           `json:"from"`        // 空投日期下限（含）
+	To          string           `json:"to"`          // 空投日期上限（含）
+	Count       int              `json:"count"`       // 空投数量
+	TGE         int              `json:"tge"`         // TGE数量
+	Regular     int              `json:"regular"`     // 普通空投数量
+	Valued      int              `json:"valued"`      // 有估值的空投数量
+	AvgValue    float64          `json:"avgValue"`    // 平均估值（USD），只统计有估值的
+	MedianValue float64          `json:"medianValue"` // 估值中位数（USD）
+	AvgPoints   float64          `json:"avgPoints"`   // 平均积分门槛，只统计积分可以识别的
+	Best        []StatsItem      `json:"best"`        // 每分价值最高的空投
+	Recipients  []RecipientTotal `json:"recipients"`  // 配置了积分的接收人能领取的空投
+}
+
+// statsItem 把归档记录转换为统计项，没有价格或数量时估值为0
+func statsItem(r ArchiveRecord) (StatsItem, bool, bool) {
+	cur := r.Current()
+	item := StatsItem{Token: r.Token, Name: cur.Name, Date: cur.Date, Phase: r.Phase}
+	points, hasPoints := parsePoints(cur.Points)
+	item.Points = points
+	price, hasPrice := r.LastPrice()
+	amount, hasAmount := parseAmount(cur.Amount)
+	valued := hasPrice && hasAmount
+	if valued {
+		item.Value = price * amount
+		if hasPoints && points > 0 {
+			item.ValuePerPoint = item.Value / float64(points)
+		}
+	}
+	return item, hasPoints, valued
+}
+
+// ComputeStats 统计归档记录
+// 接收人的积分按配置计算：使用积分账本的接收人按空投当天的滚动积分，其余使用当前积分；
+// 不考虑领取时消耗的积分，结果为能领取的上限
+// 参数:
+//   - cfg: 配置信息，提供接收人和积分账本
+//   - records: 归档记录
+//   - from: 空投日期下限，用于报告标题
+//   - to: 空投日期上限，用于报告标题
+// 返回:
+//   - Stats: 统计结果
+func ComputeStats(cfg *Config, records []ArchiveRecord, from, to string) Stats {
+	st := Stats{From: from, To: to, Count: len(records)}
+	var values []float64
+	var ranked []StatsItem
+	pointsSum, pointsCount := 0, 0
+	items := make([]StatsItem, 0, len(records))
+	for _, r := range records {
+		if r.Current().Type == "tge" {
+			st.TGE++
+		} else {
+			st.Regular++
+		}
+		item, hasPoints, valued := statsItem(r)
+		items = append(items, item)
+		if hasPoints {
+			pointsSum += item.Points
+			pointsCount++
+		}
+		if valued {
+			values = append(values, item.Value)
+		}
+		if item.ValuePerPoint > 0 {
+			ranked = append(ranked, item)
+		}
+	}
+
+	st.Valued = len(values)
+	if len(values) > 0 {
+		sum := 0.0
+		for _, v := range values {
+			sum += v
+		}
+		st.AvgValue = sum / float64(len(values))
+		sort.Float64s(values)
+		if n := len(values); n%2 == 1 {
+			st.MedianValue = values[n/2]
+		} else {
+			st.MedianValue = (values[n/2-1] + values[n/2]) / 2
+		}
+	}
+	if pointsCount > 0 {
+		st.AvgPoints = float64(pointsSum) / float64(pointsCount)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].ValuePerPoint > ranked[j].ValuePerPoint })
+	if len(ranked) > statsTopN {
+		ranked = ranked[:statsTopN]
+	}
+	st.Best = ranked
+
+	ledger, err := LoadLedger(cfg)
+	if err != nil {
+		ledger = nil // 账本无法读取时使用账本的接收人不参与统计
+	}
+	for _, rcpt := range cfg.SendKeys {
+		total := RecipientTotal{Recipient: recipientLabel(rcpt.SendKey), SendKey: rcpt.SendKey}
+		current := 0 // 不使用积分账本时的当前积分
+		if rcpt.Ledger != "" {
+			total.Recipient = rcpt.Ledger
+			if _, ok := ledger[rcpt.Ledger]; !ok {
+				continue
+			}
+		} else {
+			balance, ok, err := rcpt.Balance(cfg, time.Now())
+			if err != nil || !ok {
+				continue
+			}
+			current = balance
+		}
+		for _, item := range items {
+			balance := current
+			if rcpt.Ledger != "" {
+				day, err := time.ParseInLocation("2006-01-02", item.Date, cfg.Location())
+				if err != nil {
+					continue
+				}
+				balance, _ = ledger.Score(rcpt.Ledger, day)
+			}
+			if item.Points > 0 && balance >= item.Points {
+				total.Eligible++
+				total.Value += item.Value
+			}
+		}
+		st.Recipients = append(st.Recipients, total)
+	}
+	return st
+}
+
+// Report 生成统计的Markdown文本，包含所有接收人能领取的空投
+// 返回:
+//   - string: 报告内容
+func (st Stats) Report() string {
+	msg := st.summary()
+	if st.Count > 0 && len(st.Recipients) > 0 {
+		msg += "\n按积分可领取（不计领取消耗）：\n\n| 接收人 | 空投数 | 总估值(USD) |\n|---|---|---|\n"
+		for _, r := range st.Recipients {
+			msg += fmt.Sprintf("| %s | %d | %.2f |\n", r.Recipient, r.Eligible, r.Value)
+		}
+	}
+	return msg
+}
+
+// summary 生成不含接收人的统计文本，周报推送时每个接收人只附上自己的一行
+func (st Stats) summary() string {
+	msg := fmt.Sprintf("统计范围：%s 至 %s\n\n", st.From, st.To)
+	if st.Count == 0 {
+		return msg + "这段时间没有归档的空投。\n"
+	}
+	msg += fmt.Sprintf("- 空投数量：%d（TGE %d，普通 %d）\n", st.Count, st.TGE, st.Regular)
+	if st.Valued > 0 {
+		msg += fmt.Sprintf("- 估值：平均 %.2f USD，中位数 %.2f USD（%d个有价格）\n", st.AvgValue, st.MedianValue, st.Valued)
+	} else {
+		msg += "- 估值：没有查到价格\n"
+	}
+	msg += fmt.Sprintf("- 平均积分门槛：%.1f\n", st.AvgPoints)
+
+	if len(st.Best) > 0 {
+		msg += "\n每分价值最高：\n\n| 项目 | 日期 | 阶段 | 积分 | 估值(USD) | 每分价值 |\n|---|---|---|---|---|---|\n"
+		for _, b := range st.Best {
+			msg += fmt.Sprintf("| %s(%s) | %s | %d | %d | %.2f | %.2f |\n", b.Token, b.Name, b.Date, b.Phase, b.Points, b.Value, b.ValuePerPoint)
+		}
+	}
+	return msg
+}
+
+// LoadStats 查询一段时间内的归档并统计
+// 参数:
+//   - cfg: 配置信息
+//   - from: 空投日期下限（含），格式为2006-01-02
+//   - to: 空投日期上限（含），格式为2006-01-02
+// 返回:
+//   - Stats: 统计结果
+//   - error: 查询归档失败时返回错误
+func LoadStats(cfg *Config, from, to string) (Stats, error) {
+	records, err := QueryArchive(cfg, ArchiveQuery{From: from, To: to})
+	if err != nil {
+		return Stats{}, err
+	}
+	return ComputeStats(cfg, records, from, to), nil
+}
+
+// weeklyReportState 周报发送记录
+type weeklyReportState struct {
+	LastSent string   `json:"lastSent"`       // 最后一次发完的日期
+	Date     string   `json:"date,omitempty"` // 正在发送的日期，中途中止时下个周期继续
+	Sent     []string `json:"sent,omitempty"` // 该日期已发送的接收人（SendKey的脱敏标识）
+}
+
+// SendWeeklyReport 到了配置的星期和时间时推送上周的统计，每天最多一次
+// 配置了积分的接收人在消息末尾只看到自己能领取的空投；每发完一个接收人就记录进度，
+// 中途中止时下个周期只发给剩余的接收人；回放时不推送
+// 参数:
+//   - ctx: 控制取消的上下文
+func (s *AirdropService) SendWeeklyReport(ctx context.Context) {
+	cfg := s.config.Stats
+	if !cfg.Weekly || s.replaying() {
+		return
+	}
+	now := s.now().In(s.config.Location())
+	if now.Weekday() != cfg.weekday() || now.Hour() < cfg.hour() {
+		return
+	}
+	logger := Logger(ctx)
+	path := s.config.StatePath(weeklyReportFile)
+	today := now.Format("2006-01-02")
+	var state weeklyReportState
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	if state.LastSent == today {
+		return
+	}
+	if state.Date != today {
+		state.Date, state.Sent = today, nil
+	}
+	sent := make(map[string]bool)
+	for _, label := range state.Sent {
+		sent[label] = true
+	}
+	save := func() {
+		data, _ := json.Marshal(state)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			logger.Error("保存周报记录失败", LogKeyPath, path, LogKeyError, err)
+		}
+	}
+
+	from, to := now.AddDate(0, 0, -7).Format("2006-01-02"), now.AddDate(0, 0, -1).Format("2006-01-02")
+	st, err := LoadStats(s.config, from, to)
+	if err != nil {
+		logger.Error("生成周报失败", LogKeyError, err)
+		return
+	}
+	report := st.summary()
+	own := make(map[string]RecipientTotal)
+	for _, r := range st.Recipients {
+		own[r.SendKey] = r
+	}
+
+	logger.Info("推送空投周报", LogKeyCount, st.Count, "already_sent", len(state.Sent))
+	for _, r := range s.config.SendKeys {
+		label := recipientLabel(r.SendKey)
+		if sent[label] {
+			continue
+		}
+		body := report
+		if total, ok := own[r.SendKey]; ok && st.Count > 0 {
+			body += fmt.Sprintf("\n你（%s）按积分可领取 %d 个，总估值 %.2f USD（不计领取消耗）\n", total.Recipient, total.Eligible, total.Value)
+		}
+		if err := sendToKeys(ctx, body, "空投周报", s.config, []string{r.SendKey}); err != nil {
+			logger.Error("周报推送中止", LogKeyError, err)
+			return // 没有发完，下个周期继续发给剩余的接收人
+		}
+		sent[label] = true
+		state.Sent = append(state.Sent, label)
+		save()
+	}
+
+	state.LastSent, state.Date, state.Sent = today, "", nil
+	save()
+}
@@ -4,11 +4,13 @@ package internal
 
 import (
 	"compress/gzip"    // 用于处理gzip压缩的响应
+	"context"         // 用于取消和超时控制
 	"crypto/md5"      // 用于计算消息的MD5哈希
 	"encoding/hex"    // 用于将MD5哈希转换为十六进制字符串
 	"encoding/json"   // 用于JSON编码和解码
-	"fmt"            // 用于格式化输出
+	"errors"          // 用于构造推送失败的错误
 	"io"             // 用于I/O操作
+	"log/slog"       // 用于结构化日志
 	"net/http"       // 用于HTTP请求
 	"os"             // 用于文件操作
 	"strings"        // 用于字符串处理
@@ -20,9 +22,97 @@ import (
 // Config 配置结构体
 // 用于存储应用程序的配置信息，从config.json文件中加载
 type Config struct {
-	SendKeys []string `json:"sendkeys"` // Server酱的推送密钥列表
-	Interval int      `json:"interval"` // 检查间隔时间（分钟）
-	FiterTge bool     `json:"fiterTge"` // 是否过滤TGE类型的空投项目
+	SendKeys []Recipient `json:"sendkeys"` // 推送接收人，每项为SendKey字符串或带积分的对象
+	Interval int         `json:"interval"` // 检查间隔时间（分钟）
+	FiterTge bool        `json:"fiterTge"` // 是否过滤TGE类型的空投项目
+	Timezone string      `json:"timezone"` // 上游日期时间所在的时区，默认Asia/Shanghai
+
+	CycleTimeout int `json:"cycleTimeout"` // 单次检查周期的最长耗时（秒），0表示使用默认值
+
+	Retry        map[string]RetryConfig `json:"retry"`        // 按接口名（data、price）配置的重试策略
+	PriceBreaker BreakerConfig          `json:"priceBreaker"` // 价格接口熔断器配置
+
+	StateDir     string `json:"stateDir"`     // 快照、缓存等状态文件所在目录，默认为../data
+	MaxStaleness int    `json:"maxStaleness"` // 上游不可用时缓存数据的最长可用时间（分钟），-1表示禁用
+
+	Guard     GuardConfig `json:"guard"`     // 上游响应合理性检查配置
+	AlertKeys []string    `json:"alertKeys"` // 接收运维告警的Server酱SendKey，为空时告警只打印到控制台
+
+	HTMLSource HTMLSourceConfig `json:"htmlSource"` // JSON接口失败时抓取公开页面的备用来源
+	Merge      MergeConfig      `json:"merge"`      // 同时使用多个来源并合并的配置
+
+	OverridesFile string `json:"overridesFile"` // 本地覆盖文件路径，默认为状态目录下的overrides.json
+
+	Capture CaptureConfig `json:"capture"` // 上游流量录制与回放，默认关闭
+	Log     LogConfig     `json:"log"`     // 日志级别和格式
+	Server  ServerConfig  `json:"server"`  // 本地HTTP服务（指标、健康检查等），默认不启动
+	Health  HealthConfig  `json:"health"`  // 健康检查的就绪阈值
+
+	Calendar CalendarConfig `json:"calendar"` // iCalendar导出的提醒设置
+	Feed     FeedConfig     `json:"feed"`     // 变化事件订阅源（Atom/RSS）
+
+	Message   MessageConfig  `json:"message"`   // 推送消息的格式，如表格的排列方式
+	Reminders ReminderConfig `json:"reminders"` // 空投开始前的提醒
+	Polling   PollingConfig  `json:"polling"`   // daemon的自适应检查间隔
+	Stats     StatsConfig    `json:"stats"`     // 基于历史归档的统计周报
+
+	PointsBalances []PointsBalance `json:"pointsBalances"` // 已弃用：旧版的接收人积分，加载时合并到sendkeys中相同SendKey的接收人
+
+	// 敏感信息也可以放在文件中，或通过SENDKEYS、ALERT_KEYS、CF_COOKIE（及对应的_FILE）环境变量提供
+	SendKeysFile  string `json:"sendkeysFile"`  // SendKey文件，每行或逗号分隔一个
+	AlertKeysFile string `json:"alertKeysFile"` // 告警SendKey文件
+	CookieFile    string `json:"cookieFile"`    // CloudFlare Cookie文件
+
+	cookie string // 加载后的上游Cookie，不从config.json读取
+}
+
+// defaultCycleTimeout 未配置cycleTimeout时使用的默认周期超时时间
+const defaultCycleTimeout = 3 * time.Minute
+
+// defaultCheckInterval 未配置interval时daemon模式的检查间隔
+const defaultCheckInterval = 5 * time.Minute
+
+// SnapshotFile 快照文件名，位于状态目录下
+const SnapshotFile = "last_snapshot.txt"
+
+// CheckInterval 返回daemon模式的检查间隔
+// 返回:
+//   - time.Duration: 检查间隔，未配置时为5分钟
+func (c *Config) CheckInterval() time.Duration {
+	if c == nil || c.Interval <= 0 {
+		return defaultCheckInterval
+	}
+	return time.Duration(c.Interval) * time.Minute
+}
+
+// defaultTimezone 未配置timezone时上游日期时间所在的时区
+const defaultTimezone = "Asia/Shanghai"
+
+// Location 返回上游日期时间所在的时区
+// 返回:
+//   - *time.Location: 时区，配置无法识别或系统没有时区数据库时为UTC+8
+func (c *Config) Location() *time.Location {
+	name := defaultTimezone
+	if c != nil && c.Timezone != "" {
+		name = c.Timezone
+	}
+	if loc, err := time.LoadLocation(name); err == nil {
+		return loc
+	} else if name != defaultTimezone {
+		slog.Warn("无法识别时区，使用默认时区", "timezone", name, LogKeyError, err)
+	}
+	return time.FixedZone("CST", 8*60*60)
+}
+
+// CycleDeadline 返回单次检查周期允许的最长耗时
+// 配置为空或未设置cycleTimeout时返回默认值
+// 返回:
+//   - time.Duration: 周期超时时间
+func (c *Config) CycleDeadline() time.Duration {
+	if c == nil || c.CycleTimeout <= 0 {
+		return defaultCycleTimeout
+	}
+	return time.Duration(c.CycleTimeout) * time.Second
 }
 
 // LoadConfig 读取配置文件
@@ -44,6 +134,14 @@ func LoadConfig(configPath string) (*Config, error) {
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, err // JSON解析失败
 	}
+
+	// 用环境变量或密钥文件中的值覆盖，并登记到脱敏器
+	if err := cfg.loadSecrets(); err != nil {
+		return nil, err
+	}
+
+	// 兼容旧版的pointsBalances配置
+	cfg.foldPointsBalances()
 	
 	return &cfg, nil // 返回配置对象指针
 }
@@ -74,30 +172,144 @@ func readResponseBody(resp *http.Response) ([]byte, error) {
 	return io.ReadAll(reader)
 }
 
+// sleepWithContext 等待指定时长，期间如果ctx被取消则立即返回
+// 用于替代重试和限流中的time.Sleep，使关闭程序或周期超时时能及时中断
+// 参数:
+//   - ctx: 控制取消的上下文
+//   - d: 等待时长
+// 返回:
+//   - error: ctx被取消时返回ctx.Err()，正常等待结束返回nil
+func sleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// scSendWithContext 调用Server酱SDK发送单条消息，并在ctx取消时提前返回
+// SDK本身不支持context，这里在独立goroutine中发送，调用方不必等待其结束
+// 参数:
+//   - ctx: 控制取消的上下文
+//   - sendkey: Server酱推送密钥
+//   - title: 消息标题
+//   - msg: 消息内容
+// 返回:
+//   - *serverchan_sdk.ScSendResponse: Server酱响应
+//   - error: 发送失败或ctx被取消时返回错误
+func scSendWithContext(ctx context.Context, sendkey, title, msg string) (*serverchan_sdk.ScSendResponse, error) {
+	type result struct {
+		resp *serverchan_sdk.ScSendResponse
+		err  error
+	}
+	done := make(chan result, 1) // 带缓冲，ctx取消后goroutine仍可写入并退出
+	go func() {
+		resp, err := serverchan_sdk.ScSend(sendkey, title, msg, nil)
+		done <- result{resp, RedactError(err)} // SDK的错误信息中可能带有包含SendKey的请求地址
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-done:
+		return r.resp, r.err
+	}
+}
+
 // SendToServerChan 发送消息到Server酱
 // 该函数使用Server酱SDK将消息推送到指定的接收端（如微信）
 // 参数:
+//   - ctx: 控制取消的上下文，取消后不再发送剩余的SendKey
 //   - msg: 要发送的消息内容
 //   - title: 消息标题
 //   - cfg: 包含SendKeys的配置对象
 // 返回:
-//   - error: 目前总是返回nil，实际错误会打印到控制台
-func SendToServerChan(msg string, title string, cfg *Config) error {
+//   - error: ctx被取消时返回ctx.Err()，单个SendKey的发送错误只打印到控制台
+func SendToServerChan(ctx context.Context, msg string, title string, cfg *Config) error {
+	return sendToKeys(ctx, msg, title, cfg, cfg.sendKeyList())
+}
+
+// sendToKeys 向指定的SendKey逐个发送消息，用于只通知部分接收人的场景
+// 参数:
+//   - ctx: 控制取消的上下文，取消后不再发送剩余的SendKey
+//   - msg: 要发送的消息内容
+//   - title: 消息标题
+//   - cfg: 配置对象，用于记录推送历史
+//   - sendkeys: 接收人的SendKey
+// 返回:
+//   - error: ctx被取消时返回ctx.Err()，单个SendKey的发送错误只打印到控制台
+func sendToKeys(ctx context.Context, msg string, title string, cfg *Config, sendkeys []string) error {
+	logger := Logger(ctx)
 	// 遍历所有SendKey，分别发送消息
-	for _, sendkey := range cfg.SendKeys {
+	for _, sendkey := range sendkeys {
 		// 调用Server酱SDK发送消息
-		resp, err := serverchan_sdk.ScSend(sendkey, title, msg, nil)
+		resp, err := scSendWithContext(ctx, sendkey, title, msg)
+		if err == nil && resp != nil && resp.Code != 0 {
+			recordDelivery(ctx, cfg, ChannelServerChan, sendkey, title, errors.New(resp.Message))
+		} else {
+			recordDelivery(ctx, cfg, ChannelServerChan, sendkey, title, err)
+		}
 		if err != nil {
-			// 发送失败，打印错误信息
-			fmt.Printf("推送Server酱失败: %v\n", err)
+			if ctx.Err() != nil {
+				return ctx.Err() // 周期超时或程序退出，放弃剩余推送
+			}
+			// 发送失败，记录错误信息
+			logger.Error("推送Server酱失败", LogKeyRecipient, recipientLabel(sendkey), LogKeyError, err)
+		} else if resp != nil && resp.Code != 0 {
+			// 接口返回了错误码，如SendKey无效或超出额度
+			logger.Error("Server酱返回错误", LogKeyRecipient, recipientLabel(sendkey), LogKeyStatus, resp.Code, "message", resp.Message)
 		} else {
-			// 发送成功，打印响应
-			fmt.Println("Server酱响应:", resp)
+			logger.Info("推送Server酱成功", LogKeyRecipient, recipientLabel(sendkey))
+			health.recordPush()
 		}
 		// 每次发送后等待1秒，避免频率限制
-		time.Sleep(1 * time.Second)
+		if err := sleepWithContext(ctx, 1*time.Second); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SendAlert 向运维人员发送告警
+// 告警只发给AlertKeys，不会打扰普通订阅者；未配置AlertKeys时只打印到控制台
+// 参数:
+//   - ctx: 控制取消的上下文
+//   - title: 告警标题
+//   - msg: 告警内容
+//   - cfg: 包含AlertKeys的配置对象
+// 返回:
+//   - error: ctx被取消，或配置了AlertKeys但没有一个发送成功时返回错误，调用方据此决定是否下次重发
+func SendAlert(ctx context.Context, title string, msg string, cfg *Config) error {
+	logger := Logger(ctx)
+	logger.Warn("告警", "title", title, "detail", msg)
+	if cfg == nil || len(cfg.AlertKeys) == 0 {
+		return nil
+	}
+	var lastErr error
+	delivered := false
+	for _, key := range cfg.AlertKeys {
+		resp, err := scSendWithContext(ctx, key, title, msg)
+		if err == nil && resp != nil && resp.Code != 0 {
+			err = errors.New(resp.Message)
+		}
+		recordDelivery(ctx, cfg, ChannelAlert, key, title, err)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			logger.Error("发送告警失败", LogKeyRecipient, recipientLabel(key), LogKeyError, err)
+			lastErr = err
+			continue
+		}
+		delivered = true
+	}
+	if !delivered {
+		return lastErr // 所有AlertKey都失败，返回最后一个错误
 	}
-	return nil // 始终返回nil，实际错误已在上面处理
+	return nil
 }
 
 // HashMsg 计算消息的MD5哈希值
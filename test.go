@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"alpha_wx_notify/internal"
@@ -19,7 +20,7 @@ func main() {
 	airdropService := internal.NewAirdropService(cfg)
 
 	// 获取空投数据
-	apiResp := airdropService.GetAirdropData()
+	apiResp, _ := airdropService.GetAirdropData(context.Background())
 	if apiResp == nil {
 		fmt.Println("获取空投数据失败")
 		return